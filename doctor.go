@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yolossn/terraform-provider-nebraska/internal/provider"
+)
+
+// runDoctor checks the connection and authentication to the Nebraska server.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s doctor [options]\n\nChecks that the provider can reach and authenticate against the Nebraska server.\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	providerConfig := providerConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, fmt.Errorf("unexpected arguments %v", fs.Args()))
+	}
+
+	if !provider.Doctor(context.Background(), version, providerConfig(), os.Stdout) {
+		return 1
+	}
+	return 0
+}
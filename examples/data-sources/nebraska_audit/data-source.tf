@@ -0,0 +1,16 @@
+data "nebraska_audit" "all" {
+  ignore_object_ids = ["7074264a-2070-4b84-96ed-8a269dba5021"]
+}
+
+
+check "nebraska_audit" {
+  assert {
+    condition     = data.nebraska_audit.all.error_count == 0
+    error_message = join("\n", [for f in data.nebraska_audit.all.findings : f.reason if f.severity == "error"])
+  }
+}
+
+
+output "warnings" {
+  value = [for f in data.nebraska_audit.all.findings : f.reason if f.severity == "warning"]
+}
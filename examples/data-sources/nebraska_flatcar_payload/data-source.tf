@@ -0,0 +1,8 @@
+data "nebraska_flatcar_payload" "update" {
+  path = "${path.module}/flatcar_production_update.gz"
+}
+
+
+output "metadata_size" {
+  value = data.nebraska_flatcar_payload.update.metadata_size
+}
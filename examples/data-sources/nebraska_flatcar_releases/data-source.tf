@@ -0,0 +1,11 @@
+data "nebraska_flatcar_releases" "stable" {
+  url      = "https://mirror.example.com/releases.json"
+  channels = ["stable"]
+  arches   = ["amd64"]
+  latest   = 3
+}
+
+
+output "latest_stable" {
+  value = data.nebraska_flatcar_releases.stable.latest_versions["stable"]
+}
@@ -0,0 +1,12 @@
+data "nebraska_package_usage" "old" {
+  application_id = "io.kinvolk.demo"
+  version        = "3374.2.0"
+  arch           = "amd64"
+}
+
+
+output "old_package_instances" {
+  value = {
+    for g in data.nebraska_package_usage.old.groups : g.name => g.instances
+  }
+}
@@ -1,3 +1,12 @@
 provider "nebraska" {
   endpoint = "http://localhost:8000"
-}
\ No newline at end of file
+
+  # Used by resources and data sources that omit application_id.
+  default_application = "io.kinvolk.demo"
+
+  # Changes to these channels and groups need a new confirm_change token.
+  protected {
+    channels = ["stable"]
+    groups   = ["prod-.*"]
+  }
+}
@@ -0,0 +1,2 @@
+# Applications can be imported by specifying the application ID or product ID.
+terraform import nebraska_application.example <application_id or product_id>
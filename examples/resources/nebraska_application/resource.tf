@@ -4,3 +4,13 @@ resource "nebraska_application" "demo_app" {
   description = "Demo app is used for demo purpose"
 }
 
+resource "nebraska_application" "demo_app_clone" {
+  product_id  = "io.kinvolk.demo-clone"
+  name        = "demo app clone"
+  description = "Copies the channels and groups of the demo app"
+  clone_from  = nebraska_application.demo_app.id
+}
+
+output "cloned_stable_group_id" {
+  value = nebraska_application.demo_app_clone.cloned_group_ids["stable"]
+}
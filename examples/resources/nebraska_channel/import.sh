@@ -0,0 +1,2 @@
+# Channels can be imported by specifying the application ID or product ID and the channel ID.
+terraform import nebraska_channel.example <application_id>/<channel_id>
@@ -0,0 +1,2 @@
+# Channel sets can be imported by specifying the application ID or product ID and the channel name.
+terraform import nebraska_channel_set.example <application_id>/<name>
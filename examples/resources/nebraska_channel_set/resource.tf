@@ -0,0 +1,12 @@
+resource "nebraska_channel_set" "stable" {
+  application_id = "io.kinvolk.demo"
+  name           = "stable"
+  arches         = ["amd64", "aarch64"]
+  version        = "3510.2.1"
+  color          = "#1458d4"
+}
+
+
+output "channel_ids" {
+  value = nebraska_channel_set.stable.channel_ids
+}
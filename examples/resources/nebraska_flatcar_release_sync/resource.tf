@@ -0,0 +1,8 @@
+resource "nebraska_flatcar_release_sync" "stable" {
+  application_id = "io.kinvolk.demo"
+  url            = "https://mirror.example.com/releases.json"
+  channels       = ["stable"]
+  min_version    = "3510.2.0"
+  latest         = 5
+  prune          = true
+}
@@ -0,0 +1,2 @@
+# Groups can be imported by specifying the application ID or product ID and the group ID.
+terraform import nebraska_group.example <application_id>/<group_id>
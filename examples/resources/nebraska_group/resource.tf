@@ -8,3 +8,12 @@ resource "nebraska_group" "demo_group" {
   name           = "demo group"
   application_id = nebraska_application.demo_app.id
 }
+
+resource "nebraska_group" "canary" {
+  name           = "canary"
+  application_id = nebraska_application.demo_app.id
+  policy_preset  = "canary"
+
+  # Overrides the preset.
+  policy_updates_enabled = true
+}
@@ -0,0 +1,2 @@
+# Packages can be imported by specifying the application ID or product ID and the package ID.
+terraform import nebraska_package.example <application_id>/<package_id>
@@ -16,3 +16,14 @@ resource "nebraska_package" "demo_package" {
   application_id = nebraska_application.demo_app.id
   description    = "demo package"
 }
+
+# size, hash and the flatcar_action are computed from the update payload.
+resource "nebraska_package" "flatcar" {
+  version        = "3510.2.1"
+  url            = "https://update.release.flatcar-linux.net/amd64-usr/3510.2.1/"
+  filename       = "flatcar_production_update.gz"
+  source_file    = "${path.module}/flatcar_production_update.gz"
+  arch           = "amd64"
+  application_id = nebraska_application.demo_app.id
+  description    = "Flatcar 3510.2.1"
+}
@@ -0,0 +1,14 @@
+# Deletes the packages older than 90 days, except the 3 newest of each arch
+# and the ones channels point to.
+resource "nebraska_package_retention" "flatcar" {
+  application_id = "io.kinvolk.demo"
+  keep_latest    = 3
+  keep_days      = 90
+  keep_versions  = ["3374.2.5"]
+  dry_run        = true
+}
+
+
+output "candidates" {
+  value = [for p in nebraska_package_retention.flatcar.candidates : "${p.version} (${p.arch})"]
+}
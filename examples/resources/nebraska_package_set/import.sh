@@ -0,0 +1,2 @@
+# Package sets can be imported by specifying the application ID or product ID and the version.
+terraform import nebraska_package_set.example <application_id>/<version>
@@ -0,0 +1,26 @@
+resource "nebraska_package_set" "flatcar" {
+  application_id = "io.kinvolk.demo"
+  version        = "3510.2.1"
+  description    = "Flatcar 3510.2.1"
+
+  amd64 {
+    url      = "https://update.release.flatcar-linux.net/amd64-usr/3510.2.1/"
+    filename = "flatcar_production_update.gz"
+    size     = "465881871"
+    hash     = "r3nufcxgMTZaxYEqL+x2zIoeClk="
+    sha256   = "LIkAKVZY2EJFiwTmltiJZLFLA5xT/FodbjVgqkyF/y8="
+  }
+
+  aarch64 {
+    url      = "https://update.release.flatcar-linux.net/arm64-usr/3510.2.1/"
+    filename = "flatcar_production_update.gz"
+    size     = "401234567"
+    hash     = "mJtzTSUE+Y7w4Ka8xYbbb4pXpVQ="
+    sha256   = "8sTxxrhKQuQpqPxgy3r0GmLQGV8OdO3XhQeyNvdNHYE="
+  }
+}
+
+
+output "package_ids" {
+  value = nebraska_package_set.flatcar.package_ids
+}
@@ -0,0 +1,37 @@
+resource "nebraska_rollout" "flatcar_3510_2_2" {
+  application_id = "io.kinvolk.demo"
+  poll_interval  = "5 minutes"
+
+  wave {
+    name          = "canary"
+    groups        = [nebraska_group.canary.id]
+    channel_id    = nebraska_channel.canary.id
+    package_id    = nebraska_package.flatcar.id
+    soak_duration = "1 hours"
+  }
+
+  wave {
+    name                = "ten-percent"
+    groups              = [nebraska_group.early.id]
+    channel_id          = nebraska_channel.stable.id
+    package_id          = nebraska_package.flatcar.id
+    min_updated_percent = 95
+    max_error_percent   = 1
+    soak_duration       = "4 hours"
+    timeout             = "6 hours"
+  }
+
+  wave {
+    name                = "everyone"
+    groups              = [nebraska_group.prod_eu.id, nebraska_group.prod_us.id]
+    channel_id          = nebraska_channel.stable.id
+    min_updated_percent = 90
+    max_error_percent   = 1
+    timeout             = "1 days"
+  }
+
+  timeouts {
+    create = "48h"
+    update = "48h"
+  }
+}
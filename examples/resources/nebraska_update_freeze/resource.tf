@@ -0,0 +1,9 @@
+# Stops all the updates of the application, remove it to restore them.
+resource "nebraska_update_freeze" "incident" {
+  application_id = "io.kinvolk.demo"
+}
+
+
+output "drift" {
+  value = nebraska_update_freeze.incident.drift
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/yolossn/terraform-provider-nebraska/internal/provider"
+)
+
+// runExport writes the Terraform configuration of an existing Nebraska server.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [options]\n\nWrites a .tf file with import blocks per application of the Nebraska server.\n\nOptions:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	providerConfig := providerConfigFlags(fs)
+	outputDir := fs.String("out", ".", "directory the .tf files are written to")
+	applications := fs.String("applications", "", "comma separated IDs or product IDs of the applications to export, all when empty")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, fmt.Errorf("unexpected arguments %v", fs.Args()))
+	}
+
+	opts := provider.ExportOptions{
+		ProviderConfig: providerConfig(),
+		OutputDir:      *outputDir,
+	}
+	if *applications != "" {
+		opts.Applications = strings.Split(*applications, ",")
+	}
+
+	if err := provider.Export(context.Background(), version, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
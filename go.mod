@@ -3,9 +3,12 @@ module github.com/yolossn/terraform-provider-nebraska
 go 1.16
 
 require (
+	github.com/hashicorp/go-cty v1.4.1-0.20200414143053-d3edf31b6320
+	github.com/hashicorp/hcl/v2 v2.11.1
 	github.com/hashicorp/terraform-plugin-docs v0.7.0
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.14.0
 	github.com/kinvolk/nebraska/backend v0.0.0-20220429094754-e2dc59727c74
+	github.com/zclconf/go-cty v1.10.0
 )
 
 require (
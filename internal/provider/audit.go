@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+type auditSeverity string
+
+const (
+	auditError   auditSeverity = "error"
+	auditWarning auditSeverity = "warning"
+	auditInfo    auditSeverity = "info"
+)
+
+// auditSeverityRank orders the findings, the most severe first.
+var auditSeverityRank = map[auditSeverity]int{auditError: 0, auditWarning: 1, auditInfo: 2}
+
+// auditFinding is an orphan or misconfigured object of an application.
+type auditFinding struct {
+	Severity      auditSeverity
+	Kind          string
+	ApplicationID string
+	ObjectType    string
+	ObjectID      string
+	ObjectName    string
+	Reason        string
+}
+
+// auditApplication returns the findings of the channels, groups and packages
+// of app.
+func auditApplication(ctx context.Context, c *apiClient, app codegen.Application) ([]auditFinding, error) {
+	channels, err := c.listChannels(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := c.listGroups(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := c.listPackages(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	return auditObjects(app, channels, groups, packages), nil
+}
+
+func auditObjects(app codegen.Application, channels []codegen.Channel, groups []codegen.Group, packages []codegen.Package) []auditFinding {
+	findings := []auditFinding{}
+	finding := func(severity auditSeverity, kind, objectType, objectID, objectName, reason string, args ...interface{}) {
+		findings = append(findings, auditFinding{
+			Severity:      severity,
+			Kind:          kind,
+			ApplicationID: app.Id,
+			ObjectType:    objectType,
+			ObjectID:      objectID,
+			ObjectName:    objectName,
+			Reason:        fmt.Sprintf(reason, args...),
+		})
+	}
+
+	packagesByID := map[string]codegen.Package{}
+	for _, pkg := range packages {
+		packagesByID[pkg.Id] = pkg
+	}
+	channelsByID := map[string]codegen.Channel{}
+	usedPackages := map[string]bool{}
+	for _, channel := range channels {
+		channelsByID[channel.Id] = channel
+		switch _, ok := packagesByID[channel.PackageID]; {
+		case channel.PackageID == "":
+			finding(auditWarning, "channel_without_package", "channel", channel.Id, channel.Name,
+				"channel %q has no package, the groups using it get no updates", channel.Name)
+		case !ok:
+			finding(auditError, "channel_missing_package", "channel", channel.Id, channel.Name,
+				"channel %q points to package %s, which doesn't exist", channel.Name, channel.PackageID)
+		default:
+			usedPackages[channel.PackageID] = true
+		}
+	}
+
+	for _, group := range groups {
+		switch _, ok := channelsByID[group.ChannelID]; {
+		case group.ChannelID == "":
+			finding(auditWarning, "group_without_channel", "group", group.Id, group.Name,
+				"group %q has no channel, its instances get no updates", group.Name)
+		case !ok:
+			finding(auditError, "group_missing_channel", "group", group.Id, group.Name,
+				"group %q points to channel %s, which doesn't exist", group.Name, group.ChannelID)
+		}
+		if !group.PolicyUpdatesEnabled {
+			finding(auditInfo, "group_updates_disabled", "group", group.Id, group.Name,
+				"group %q has updates disabled", group.Name)
+		}
+	}
+
+	for _, pkg := range packages {
+		if !usedPackages[pkg.Id] {
+			finding(auditInfo, "unused_package", "package", pkg.Id, pkg.Version,
+				"package %s (%s) isn't the package of any channel", pkg.Version, pkg.Id)
+		}
+	}
+	return findings
+}
+
+// sortAuditFindings sorts findings by application, severity, kind and object
+// name.
+func sortAuditFindings(findings []auditFinding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.ApplicationID != b.ApplicationID {
+			return a.ApplicationID < b.ApplicationID
+		}
+		if a.Severity != b.Severity {
+			return auditSeverityRank[a.Severity] < auditSeverityRank[b.Severity]
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ObjectName < b.ObjectName
+	})
+}
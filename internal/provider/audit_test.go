@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestAudit(t *testing.T) {
+	otherAppID := "e96281a6-d1af-4bde-9a0a-97b76e56dc57"
+	fake, server := newFakeNebraska(t)
+	fake.apps = []codegen.Application{
+		{Id: testAppID, ProductId: "io.kinvolk.demo", Name: "Demo"},
+		{Id: otherAppID, ProductId: "io.kinvolk.other", Name: "Other"},
+	}
+	fake.packages[testAppID] = []codegen.Package{{Id: "pkg-1", Version: "3510.2.1"}, {Id: "pkg-2", Version: "3374.2.0"}}
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-stable", Name: "stable", PackageID: "pkg-1"},
+		{Id: "ch-beta", Name: "beta"},
+		{Id: "ch-alpha", Name: "alpha", PackageID: "pkg-gone"},
+	}
+	fake.groups[testAppID] = []codegen.Group{
+		{Id: "grp-prod", Name: "prod", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+		{Id: "grp-lab", Name: "lab", PolicyUpdatesEnabled: true},
+		{Id: "grp-paused", Name: "paused", ChannelID: "ch-stable"},
+		{Id: "grp-old", Name: "old", ChannelID: "ch-deleted", PolicyUpdatesEnabled: true},
+	}
+	fake.groups[otherAppID] = []codegen.Group{{Id: "grp-other", Name: "other"}}
+	c := newFakeClient(t, server, nil)
+
+	d := schema.TestResourceDataRaw(t, dataSourceAudit().Schema, map[string]interface{}{
+		"application_ids":   []interface{}{"io.kinvolk.demo"},
+		"ignore_object_ids": []interface{}{"grp-paused"},
+	})
+	if diags := dataSourceAuditRead(context.Background(), d, c); diags.HasError() {
+		t.Fatalf("read failed: %#v", diags)
+	}
+	want := []string{
+		"error channel_missing_package ch-alpha",
+		"error group_missing_channel grp-old",
+		"warning channel_without_package ch-beta",
+		"warning group_without_channel grp-lab",
+		"info unused_package pkg-2",
+	}
+	findings := d.Get("findings").([]interface{})
+	if len(findings) != len(want) {
+		t.Fatalf("got findings %#v, want %v", findings, want)
+	}
+	for i, f := range findings {
+		f := f.(map[string]interface{})
+		if got := f["severity"].(string) + " " + f["kind"].(string) + " " + f["object_id"].(string); got != want[i] || f["application_id"] != testAppID {
+			t.Errorf("got finding %d %#v, want %q", i, f, want[i])
+		}
+	}
+	if d.Get("error_count") != 2 || d.Get("warning_count") != 2 {
+		t.Errorf("got %v errors and %v warnings, want 2 and 2", d.Get("error_count"), d.Get("warning_count"))
+	}
+
+	// all the applications are scanned by default.
+	d = schema.TestResourceDataRaw(t, dataSourceAudit().Schema, map[string]interface{}{})
+	if diags := dataSourceAuditRead(context.Background(), d, c); diags.HasError() {
+		t.Fatalf("read failed: %#v", diags)
+	}
+	findings = d.Get("findings").([]interface{})
+	if len(findings) != 8 {
+		t.Fatalf("got %d findings, want 8: %#v", len(findings), findings)
+	}
+	if last := findings[7].(map[string]interface{}); last["object_id"] != "grp-other" || last["kind"] != "group_updates_disabled" {
+		t.Errorf("unexpected finding %#v", last)
+	}
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// errChannelNotFound is returned when a channels_blacklist entry matches no
+// channel. Names are resolved when planning, so the channels they refer to
+// must exist by then.
+var errChannelNotFound = errors.New("channel not found")
+
+// resolveChannelRef returns the channel ref refers to: a channel ID, a
+// channel name or <name>/<arch>. A name shared by channels of several arches
+// refers to the channel of the package arch.
+func resolveChannelRef(channels []codegen.Channel, arch string, ref string) (codegen.Channel, error) {
+	var named []codegen.Channel
+	for _, channel := range channels {
+		if channel.Id == ref {
+			return channel, nil
+		}
+		if channel.Name == ref {
+			named = append(named, channel)
+		}
+	}
+	if len(named) == 0 {
+		if i := strings.LastIndex(ref, "/"); i >= 0 {
+			name, refArch := ref[:i], ref[i+1:]
+			for _, channel := range channels {
+				if channel.Name == name && api.Arch(channel.Arch).String() == refArch {
+					return channel, nil
+				}
+			}
+		}
+		return codegen.Channel{}, fmt.Errorf("%w: %q", errChannelNotFound, ref)
+	}
+	if len(named) == 1 {
+		return named[0], nil
+	}
+	for _, channel := range named {
+		if api.Arch(channel.Arch).String() == arch {
+			return channel, nil
+		}
+	}
+	return codegen.Channel{}, fmt.Errorf("channel name %q is used by several arches, use %q", ref, ref+"/<arch>")
+}
+
+// resolveChannelsBlacklist returns the channels refs refer to.
+func resolveChannelsBlacklist(channels []codegen.Channel, arch string, refs []string) ([]codegen.Channel, error) {
+	resolved := make([]codegen.Channel, 0, len(refs))
+	for _, ref := range refs {
+		channel, err := resolveChannelRef(channels, arch, ref)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, channel)
+	}
+	return resolved, nil
+}
+
+// channelsBlacklistRefs returns the channels_blacklist entries of the channels
+// ids, keeping the entries of previous that refer to them. The other channels
+// are referred to by name, or <name>/<arch> when the name is ambiguous.
+func channelsBlacklistRefs(channels []codegen.Channel, arch string, ids []string, previous []string) []string {
+	kept := map[string]string{}
+	for _, ref := range previous {
+		if channel, err := resolveChannelRef(channels, arch, ref); err == nil {
+			kept[channel.Id] = ref
+		}
+	}
+
+	refs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if ref, ok := kept[id]; ok {
+			refs = append(refs, ref)
+			continue
+		}
+		ref := id
+		for _, channel := range channels {
+			if channel.Id != id {
+				continue
+			}
+			ref = channel.Name
+			if resolved, err := resolveChannelRef(channels, arch, ref); err != nil || resolved.Id != id {
+				ref = channel.Name + "/" + api.Arch(channel.Arch).String()
+			}
+		}
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// customizeDiffPackageChannelsBlacklist plans the channels_blacklist_ids and
+// fails when a blacklisted channel points to the package.
+func customizeDiffPackageChannelsBlacklist(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("channels_blacklist") || !d.NewValueKnown("application_id") {
+		return d.SetNewComputed("channels_blacklist_ids")
+	}
+	refs := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
+	if len(refs) == 0 {
+		return d.SetNew("channels_blacklist_ids", []string{})
+	}
+	c := meta.(*apiClient)
+
+	appRef := d.Get("application_id").(string)
+	if appRef == "" {
+		appRef = c.defaultApplicationID
+	}
+	if appRef == "" {
+		// applying fails with the missing application.
+		return nil
+	}
+	appID, err := c.resolveApplicationID(ctx, appRef)
+	if err != nil {
+		return err
+	}
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch channels: %w", err)
+	}
+	resolved, err := resolveChannelsBlacklist(channels, d.Get("arch").(string), refs)
+	if errors.Is(err, errChannelNotFound) {
+		return fmt.Errorf("channels_blacklist: %w, refer to a channel created in the same configuration by ID, e.g. nebraska_channel.beta.id", err)
+	}
+	if err != nil {
+		return fmt.Errorf("channels_blacklist: %w", err)
+	}
+
+	ids := make([]string, 0, len(resolved))
+	for _, channel := range resolved {
+		if d.Id() != "" && channel.PackageID == d.Id() {
+			return fmt.Errorf("channels_blacklist: channel %q (%s) points to this package, point it to another package before blacklisting it", channel.Name, api.Arch(channel.Arch).String())
+		}
+		ids = append(ids, channel.Id)
+	}
+	return d.SetNew("channels_blacklist_ids", ids)
+}
+
+// packageChannelsBlacklistIDs resolves the channels_blacklist of the package
+// d to channel IDs.
+func packageChannelsBlacklistIDs(ctx context.Context, c *apiClient, appID string, d *schema.ResourceData) ([]string, diag.Diagnostics) {
+	refs := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
+	if len(refs) == 0 {
+		return []string{}, nil
+	}
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return nil, diag.Diagnostics{apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"})}
+	}
+	resolved, err := resolveChannelsBlacklist(channels, d.Get("arch").(string), refs)
+	if err != nil {
+		return nil, diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid channels_blacklist",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("channels_blacklist"),
+		}}
+	}
+	ids := make([]string, 0, len(resolved))
+	for _, channel := range resolved {
+		ids = append(ids, channel.Id)
+	}
+	return ids, nil
+}
+
+// keepChannelsBlacklist moves the channel IDs read from Nebraska into
+// channels_blacklist_ids and sets channels_blacklist to their entries,
+// keeping the entries of previous, the channels_blacklist before reading the
+// package.
+func keepChannelsBlacklist(ctx context.Context, c *apiClient, d *schema.ResourceData, previous []string) diag.Diagnostics {
+	ids := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
+	d.Set("channels_blacklist_ids", ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	channels, err := c.listChannels(ctx, d.Get("application_id").(string))
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"})}
+	}
+	d.Set("channels_blacklist", channelsBlacklistRefs(channels, d.Get("arch").(string), ids, previous))
+	return nil
+}
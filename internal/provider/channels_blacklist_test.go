@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestResolveChannelRef(t *testing.T) {
+	channels := []codegen.Channel{
+		{Id: "ch-stable-amd64", Name: "stable", Arch: 1},
+		{Id: "ch-stable-arm", Name: "stable", Arch: 2},
+		{Id: "ch-beta", Name: "beta", Arch: 2},
+	}
+	for _, tt := range []struct {
+		ref, arch, want, err string
+	}{
+		{ref: "ch-beta", arch: "amd64", want: "ch-beta"},
+		{ref: "beta", arch: "amd64", want: "ch-beta"},
+		{ref: "stable", arch: "aarch64", want: "ch-stable-arm"},
+		{ref: "stable/amd64", arch: "aarch64", want: "ch-stable-amd64"},
+		{ref: "stable", arch: "all", err: `channel name "stable" is used by several arches, use "stable/<arch>"`},
+		{ref: "alpha", arch: "amd64", err: `channel not found: "alpha"`},
+	} {
+		channel, err := resolveChannelRef(channels, tt.arch, tt.ref)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("resolving %q got error %v, want %q", tt.ref, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || channel.Id != tt.want {
+			t.Errorf("resolving %q got %q, %v, want %q", tt.ref, channel.Id, err, tt.want)
+		}
+	}
+
+	refs := channelsBlacklistRefs(channels, "all", []string{"ch-beta", "ch-stable-arm", "ch-gone"}, []string{"ch-beta"})
+	if want := []string{"ch-beta", "ch-gone", "stable/aarch64"}; strings.Join(refs, ",") != strings.Join(want, ",") {
+		t.Errorf("got refs %v, want %v", refs, want)
+	}
+}
+
+func TestResourcePackageChannelsBlacklist(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-stable", Name: "stable", Arch: 1},
+		{Id: "ch-beta", Name: "beta", Arch: 1},
+		{Id: "ch-beta-arm", Name: "beta", Arch: 2},
+	}
+	c := newFakeClient(t, server, nil)
+
+	r := resourcePackage()
+	cfg := map[string]interface{}{
+		"application_id":     testAppID,
+		"version":            "3510.2.1",
+		"arch":               "amd64",
+		"url":                "https://update.release.flatcar-linux.net/amd64-usr/3510.2.1/",
+		"filename":           "flatcar_production_update.gz",
+		"description":        "Flatcar 3510.2.1",
+		"size":               "465881871",
+		"hash":               "r3nufcxgMTZaxYEqL+x2zIoeClk=",
+		"channels_blacklist": []interface{}{"stable", "beta/aarch64"},
+	}
+	diff, err := r.SimpleDiff(context.Background(), &terraform.InstanceState{}, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	state, diags := r.Apply(context.Background(), &terraform.InstanceState{}, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if got := fake.packages[testAppID][0].ChannelsBlacklist; len(got) != 2 || !(got[0] == "ch-beta-arm" || got[1] == "ch-beta-arm") {
+		t.Errorf("unexpected blacklist %v", got)
+	}
+	if state.Attributes["channels_blacklist.#"] != "2" || state.Attributes["channels_blacklist_ids.#"] != "2" {
+		t.Errorf("unexpected state %v", state.Attributes)
+	}
+
+	// reordering the channels or reading the package back doesn't plan changes.
+	cfg["channels_blacklist"] = []interface{}{"beta/aarch64", "stable"}
+	state, diags = r.RefreshWithoutUpgrade(context.Background(), state, c)
+	if diags.HasError() {
+		t.Fatalf("refresh failed: %#v", diags)
+	}
+	diff, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	for key, attr := range diff.Attributes {
+		if strings.HasPrefix(key, "channels_blacklist") {
+			t.Errorf("unchanged blacklist planned %s: %#v", key, attr)
+		}
+	}
+
+	// names of channels yet to be created are rejected when planning.
+	cfg["channels_blacklist"] = []interface{}{"alpha"}
+	if _, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c); err == nil || !strings.Contains(err.Error(), "nebraska_channel.beta.id") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// a channel pointing to the package can't be blacklisted.
+	fake.channels[testAppID][1].PackageID = fake.packages[testAppID][0].Id
+	c.lists.invalidate(listKindChannels, testAppID)
+	cfg["channels_blacklist"] = []interface{}{"beta"}
+	if _, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c); err == nil || !strings.Contains(err.Error(), `channel "beta" (amd64) points to this package`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
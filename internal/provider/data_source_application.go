@@ -2,7 +2,6 @@ package provider
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -49,15 +48,11 @@ func dataSourceApplicationRead(ctx context.Context, d *schema.ResourceData, meta
 
 	appID := d.Get("product_id").(string)
 	appResp, err := c.client.GetAppWithResponse(ctx, appID, c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't fetch application",
-			Detail:   fmt.Sprintf("Couldnt' fetch application with product id: %s", appID),
-		})
+	if err == nil && appResp.JSON200 == nil {
+		err = newAPIError(appResp.HTTPResponse, appResp.Body)
 	}
-	if appResp.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Fetching application", appResp.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't fetch application", err, errorAttrs{application: "product_id"}))
 		return diags
 	}
 
@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func dataSourceAudit() *schema.Resource {
+	return &schema.Resource{
+		Description: "Reports the orphan and misconfigured objects of applications: groups without a channel, channels without a package, packages no channel points to and groups with updates disabled. Nebraska doesn't record when the updates of a group were disabled, so every group with updates disabled is reported, use `ignore_object_ids` to accept the known ones.",
+		ReadContext: dataSourceAuditRead,
+		Schema: map[string]*schema.Schema{
+			"application_ids": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "IDs or product IDs of the applications to scan, all the applications are scanned when unset.",
+			},
+			"ignore_object_ids": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "IDs of channels, groups or packages whose findings are left out.",
+			},
+			"id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "A hash of the scanned application IDs.",
+			},
+			"findings": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The findings, sorted by application and severity.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"severity": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "`error`, `warning` or `info`.",
+						},
+						"kind": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The kind of finding, e.g. `group_without_channel`.",
+						},
+						"application_id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "ID of the application of the object.",
+						},
+						"object_type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "`channel`, `group` or `package`.",
+						},
+						"object_id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "ID of the object.",
+						},
+						"object_name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of the object, the version of a package.",
+						},
+						"reason": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Why the object was reported.",
+						},
+					},
+				},
+			},
+			"error_count": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of findings of severity `error`.",
+			},
+			"warning_count": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of findings of severity `warning`.",
+			},
+		},
+	}
+}
+
+func dataSourceAuditRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	apps, err := c.listApplications(ctx)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't list applications", err, errorAttrs{})}
+	}
+	if refs := arrInterfaceToarrString(d.Get("application_ids").(*schema.Set).List()); len(refs) > 0 {
+		apps, err = filterApplications(ctx, c, apps, refs)
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag("Couldn't find application", err, errorAttrs{})}
+		}
+	}
+
+	ignored := map[string]bool{}
+	for _, id := range d.Get("ignore_object_ids").(*schema.Set).List() {
+		ignored[id.(string)] = true
+	}
+
+	findings := []auditFinding{}
+	for _, app := range apps {
+		appFindings, err := auditApplication(ctx, c, app)
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't scan application %q", app.Name), err, errorAttrs{})}
+		}
+		for _, f := range appFindings {
+			if !ignored[f.ObjectID] {
+				findings = append(findings, f)
+			}
+		}
+	}
+	sortAuditFindings(findings)
+
+	items := make([]map[string]interface{}, 0, len(findings))
+	counts := map[auditSeverity]int{}
+	for _, f := range findings {
+		items = append(items, map[string]interface{}{
+			"severity":       string(f.Severity),
+			"kind":           f.Kind,
+			"application_id": f.ApplicationID,
+			"object_type":    f.ObjectType,
+			"object_id":      f.ObjectID,
+			"object_name":    f.ObjectName,
+			"reason":         f.Reason,
+		})
+		counts[f.Severity]++
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(auditApplicationIDs(apps), ",")))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("findings", items)
+	d.Set("error_count", counts[auditError])
+	d.Set("warning_count", counts[auditWarning])
+	return nil
+}
+
+func auditApplicationIDs(apps []codegen.Application) []string {
+	ids := make([]string, 0, len(apps))
+	for _, app := range apps {
+		ids = append(ids, app.Id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -16,9 +16,11 @@ func dataSourceChannel() *schema.Resource {
 		ReadContext: dataSourceChannelRead,
 		Schema: map[string]*schema.Schema{
 			"application_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "ID of the application this channel belongs to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this channel belongs to. Defaults to the provider `default_application`.",
 			},
 			"name": {
 				Type:        schema.TypeString,
@@ -61,50 +63,20 @@ func dataSourceChannelRead(ctx context.Context, d *schema.ResourceData, meta int
 
 	var diags diag.Diagnostics
 
-	appID := d.Get("application_id").(string)
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
 	name := d.Get("name").(string)
 	arch := d.Get("arch").(string)
 
-	page := 1
-	perPage := 10
-	channelsResp, err := c.client.PaginateChannelsWithResponse(ctx, appID, &codegen.PaginateChannelsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+	channels, err := c.listChannels(ctx, appID)
 	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Fetching Channels",
-			Detail:   fmt.Sprintf("Error fetching channels:%v", err),
-		})
-		return diags
-	}
-	if channelsResp.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Fetching channels", channelsResp.HTTPResponse))
+		diags = append(diags, apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"}))
 		return diags
 	}
 
-	totalPages := channelsResp.JSON200.TotalCount / perPage
-
-	var channel *codegen.Channel
-
-	channel = filterChannelByNameArch(channelsResp.JSON200.Channels, name, arch)
-
-	for page <= totalPages && channel == nil {
-		page += 1
-		channelsResp, err := c.client.PaginateChannelsWithResponse(ctx, appID, &codegen.PaginateChannelsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
-		if err != nil {
-			diags = append(diags, diag.Diagnostic{
-				Severity: diag.Error,
-				Summary:  "Fetching Channels",
-				Detail:   fmt.Sprintf("Error fetching channels:%v", err),
-			})
-			return diags
-		}
-		if channelsResp.JSON200 == nil {
-			diags = append(diags, invalidResponseCodeDiag("Fetching channels", channelsResp.HTTPResponse))
-			return diags
-		}
-
-		channel = filterChannelByNameArch(channelsResp.JSON200.Channels, name, arch)
-	}
+	channel := filterChannelByNameArch(channels, name, arch)
 
 	if channel == nil {
 		diags = append(diags, diag.Diagnostic{
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceFlatcarPayload() *schema.Resource {
+	return &schema.Resource{
+		Description: "The metadata of a local Flatcar update payload, parsed from its header, for the arguments of a `nebraska_package`.",
+		ReadContext: dataSourceFlatcarPayloadRead,
+		Schema: map[string]*schema.Schema{
+			"path": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "Path of the update payload, e.g. `flatcar_production_update.gz`. The payload may be gzip compressed.",
+			},
+
+			"id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The base64 encoded sha256 hash of the payload.",
+			},
+			"size": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The size of the payload file, in bytes.",
+			},
+			"hash": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The base64 encoded sha1 hash of the payload file.",
+			},
+			"sha256": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The base64 encoded sha256 hash of the payload file.",
+			},
+			"is_delta": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the payload is a delta update applying on top of a previous version.",
+			},
+			"metadata_size": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The size of the payload header and manifest, in bytes.",
+			},
+			"metadata_signature_rsa": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The base64 encoded signature of the payload metadata, empty for version 1 payloads which don't embed it.",
+			},
+			"payload_version": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The version of the payload format.",
+			},
+			"manifest_size": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The size of the payload manifest, in bytes.",
+			},
+		},
+	}
+}
+
+func dataSourceFlatcarPayloadRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	payload, err := readFlatcarPayloadFile(d.Get("path").(string))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Couldn't read update payload",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("path"),
+		}}
+	}
+
+	d.SetId(payload.SHA256)
+	d.Set("size", strconv.FormatInt(payload.Size, 10))
+	d.Set("hash", payload.SHA1)
+	d.Set("sha256", payload.SHA256)
+	d.Set("is_delta", payload.IsDelta)
+	d.Set("metadata_size", strconv.FormatUint(payload.MetadataSize, 10))
+	d.Set("metadata_signature_rsa", payload.metadataSignatureRSA())
+	d.Set("payload_version", int(payload.Version))
+	d.Set("manifest_size", strconv.FormatUint(payload.ManifestSize, 10))
+	return nil
+}
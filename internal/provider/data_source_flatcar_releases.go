@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceFlatcarReleases() *schema.Resource {
+	s := flatcarFeedSchema()
+	s["id"] = &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "A hash of the selected releases.",
+	}
+	s["releases"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Description: "The selected releases, a release per version and architecture sorted by version.",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"version": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Flatcar version.",
+				},
+				"channel": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Channel of the release.",
+				},
+				"release_date": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Release date.",
+				},
+				"arch": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Nebraska arch of the payload.",
+				},
+				"url": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "URL of the directory of the payload, the `url` of a `nebraska_package`.",
+				},
+				"filename": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "Filename of the payload.",
+				},
+				"size": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The size of the payload, in bytes, empty when the feed doesn't publish it.",
+				},
+				"hash": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The base64 encoded sha1 hash of the payload, empty when the feed doesn't publish it.",
+				},
+				"sha256": {
+					Type:        schema.TypeString,
+					Computed:    true,
+					Description: "The base64 encoded sha256 hash of the payload, empty when the feed doesn't publish it.",
+				},
+			},
+		},
+	}
+	s["latest_versions"] = &schema.Schema{
+		Type:        schema.TypeMap,
+		Computed:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "The latest selected version of each channel.",
+	}
+
+	return &schema.Resource{
+		Description: "The releases of a Flatcar release metadata JSON feed. Flatcar's feed doesn't publish the payload sizes and hashes, a mirror can add them to each release as `\"payloads\": {\"amd64\": {\"url\": ..., \"size\": ..., \"sha1\": ..., \"sha256\": ...}}`.",
+		ReadContext: dataSourceFlatcarReleasesRead,
+		Schema:      s,
+	}
+}
+
+func dataSourceFlatcarReleasesRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	releases, err := flatcarReleases(ctx, flatcarFeedOptionsFrom(d.Get))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Couldn't read the Flatcar release feed",
+			Detail:   err.Error(),
+		}}
+	}
+
+	items := make([]map[string]interface{}, 0, len(releases))
+	latest := map[string]interface{}{}
+	keys := make([]string, 0, len(releases))
+	for _, r := range releases {
+		items = append(items, map[string]interface{}{
+			"version":      r.Version,
+			"channel":      r.Channel,
+			"release_date": r.ReleaseDate,
+			"arch":         r.Arch,
+			"url":          r.URL,
+			"filename":     r.Filename,
+			"size":         r.Size,
+			"hash":         r.Hash,
+			"sha256":       r.SHA256,
+		})
+		// the releases are sorted by version.
+		latest[r.Channel] = r.Version
+		keys = append(keys, r.key())
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(keys, ",")))
+	d.SetId(hex.EncodeToString(sum[:]))
+	d.Set("releases", items)
+	d.Set("latest_versions", latest)
+	return nil
+}
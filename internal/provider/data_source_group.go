@@ -15,9 +15,11 @@ func dataSourceGroup() *schema.Resource {
 		ReadContext: dataSourceGroupRead,
 		Schema: map[string]*schema.Schema{
 			"application_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "Application Id of the group",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this group belongs to. Defaults to the provider `default_application`.",
 			},
 			"name": {
 				Type:        schema.TypeString,
@@ -99,48 +101,19 @@ func dataSourceGroupRead(ctx context.Context, d *schema.ResourceData, meta inter
 
 	var diags diag.Diagnostics
 
-	appID := d.Get("application_id").(string)
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
 	name := d.Get("name").(string)
 
-	page := 1
-	perPage := 10
-	groupsResp, err := c.client.PaginateGroupsWithResponse(ctx, appID, &codegen.PaginateGroupsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+	groups, err := c.listGroups(ctx, appID)
 	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Fetching Groups",
-			Detail:   fmt.Sprintf("Error fetching groups: %v", err),
-		})
+		diags = append(diags, apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"}))
 		return diags
 	}
-	if groupsResp.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Fetching group", groupsResp.HTTPResponse))
-		return diags
-	}
-
-	totalPages := groupsResp.JSON200.TotalCount / perPage
-
-	var group *codegen.Group
-
-	group = filterGroupByName(groupsResp.JSON200.Groups, name)
 
-	for page <= totalPages && group == nil {
-		page += 1
-		groupsResp, err := c.client.PaginateGroupsWithResponse(ctx, appID, &codegen.PaginateGroupsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
-		if err != nil {
-			diags = append(diags, diag.Diagnostic{
-				Severity: diag.Error,
-				Summary:  "Fetching Groups",
-				Detail:   fmt.Sprintf("Error fetching groups: %v", err),
-			})
-			return diags
-		}
-		if groupsResp.JSON200 == nil {
-			diags = append(diags, invalidResponseCodeDiag("Fetching group", groupsResp.HTTPResponse))
-			return diags
-		}
-		group = filterGroupByName(groupsResp.JSON200.Groups, name)
-	}
+	group := filterGroupByName(groups, name)
 	if group == nil {
 		diags = append(diags, diag.Diagnostic{
 			Severity: diag.Error,
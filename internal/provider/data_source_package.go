@@ -12,13 +12,6 @@ import (
 	"github.com/kinvolk/nebraska/backend/pkg/codegen"
 )
 
-var pkgTypeToString = map[int]string{
-	0: "flatcar",
-	1: "docker",
-	2: "rkt",
-	3: "other",
-}
-
 func dataSourcePackage() *schema.Resource {
 	return &schema.Resource{
 		Description: "Package of the application",
@@ -26,9 +19,10 @@ func dataSourcePackage() *schema.Resource {
 		Schema: map[string]*schema.Schema{
 			"application_id": {
 				Type:         schema.TypeString,
-				Required:     true,
-				ValidateFunc: validateProductID,
-				Description:  "Application ID",
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this package belongs to. Defaults to the provider `default_application`.",
 			},
 			"version": {
 				Type:        schema.TypeString,
@@ -162,50 +156,20 @@ func dataSourcePackageRead(ctx context.Context, d *schema.ResourceData, meta int
 
 	var diags diag.Diagnostics
 
-	appID := d.Get("application_id").(string)
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
 	version := d.Get("version").(string)
 	arch := d.Get("arch").(string)
 
-	page := 1
-	perPage := 10
-
-	packagesPage, err := c.client.PaginatePackagesWithResponse(ctx, appID, &codegen.PaginatePackagesParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+	packages, err := c.listPackages(ctx, appID)
 	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Fetching packages",
-			Detail:   fmt.Sprintf("Error fetching packages:%v", err),
-		})
+		diags = append(diags, apiErrorDiag("Couldn't fetch packages", err, errorAttrs{application: "application_id"}))
 		return diags
 	}
-	if packagesPage.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Fetching packages", packagesPage.HTTPResponse))
-		return diags
-	}
-
-	totalPages := packagesPage.JSON200.TotalCount / perPage
-
-	var nebraskaPackage *codegen.Package
 
-	nebraskaPackage = filterPackageByVersionArch(packagesPage.JSON200.Packages, version, arch)
-
-	for page <= totalPages && nebraskaPackage == nil {
-		page += 1
-		packagesPage, err := c.client.PaginatePackagesWithResponse(ctx, appID, &codegen.PaginatePackagesParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
-		if err != nil {
-			diags = append(diags, diag.Diagnostic{
-				Severity: diag.Error,
-				Summary:  "Fetching packages",
-				Detail:   fmt.Sprintf("Error fetching packages:%v", err),
-			})
-			return diags
-		}
-		if packagesPage.JSON200 == nil {
-			diags = append(diags, invalidResponseCodeDiag("Fetching packages", packagesPage.HTTPResponse))
-			return diags
-		}
-		nebraskaPackage = filterPackageByVersionArch(packagesPage.JSON200.Packages, version, arch)
-	}
+	nebraskaPackage := filterPackageByVersionArch(packages, version, arch)
 
 	if nebraskaPackage == nil {
 		diags = append(diags, diag.Diagnostic{
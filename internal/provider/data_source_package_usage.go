@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func dataSourcePackageUsage() *schema.Resource {
+	return &schema.Resource{
+		Description: "Where a package is used: the channels pointing to it, the groups using those channels and their active instances, e.g. before deleting or blacklisting the package.",
+		ReadContext: dataSourcePackageUsageRead,
+		Schema: map[string]*schema.Schema{
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this package belongs to. Defaults to the provider `default_application`.",
+			},
+			"package_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ExactlyOneOf: []string{"package_id", "version"},
+				Description:  "ID of the package.",
+			},
+			"version": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				RequiredWith: []string{"arch"},
+				Description:  "Package version, to find the package with `arch` instead of `package_id`.",
+			},
+			"arch": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				RequiredWith: []string{"version"},
+				Description:  "Package arch.",
+			},
+			"id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Package ID",
+			},
+			"channels": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The channels pointing to the package.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "ID of the channel.",
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of the channel.",
+						},
+					},
+				},
+			},
+			"groups": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The groups using the channels pointing to the package.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "ID of the group.",
+						},
+						"name": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "Name of the group.",
+						},
+						"channel_id": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The channel of the group.",
+						},
+						"policy_updates_enabled": {
+							Type:        schema.TypeBool,
+							Computed:    true,
+							Description: "Are updates enabled?",
+						},
+						"instances": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The number of instances that checked for updates in the last day.",
+						},
+					},
+				},
+			},
+			"instances": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of instances of all the groups that checked for updates in the last day.",
+			},
+		},
+	}
+}
+
+func dataSourcePackageUsageRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch packages", err, errorAttrs{application: "application_id"})}
+	}
+	var nebraskaPackage *codegen.Package
+	if packageID := d.Get("package_id").(string); packageID != "" {
+		for i := range packages {
+			if packages[i].Id == packageID {
+				nebraskaPackage = &packages[i]
+			}
+		}
+		if nebraskaPackage == nil {
+			return diag.Diagnostics{{
+				Severity: diag.Error,
+				Summary:  "Package not found",
+				Detail:   fmt.Sprintf("Package not found for ID: %q", packageID),
+			}}
+		}
+	} else {
+		version := d.Get("version").(string)
+		arch := d.Get("arch").(string)
+		nebraskaPackage = filterPackageByVersionArch(packages, version, arch)
+		if nebraskaPackage == nil {
+			return diag.Diagnostics{{
+				Severity: diag.Error,
+				Summary:  "Package not found",
+				Detail:   fmt.Sprintf("Package not found for version: %q, arch: %q", version, arch),
+			}}
+		}
+	}
+
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"})}
+	}
+	groups, err := c.listGroups(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"})}
+	}
+
+	channelItems := []map[string]interface{}{}
+	usingPackage := map[string]bool{}
+	for _, channel := range channels {
+		if channel.PackageID == nebraskaPackage.Id {
+			channelItems = append(channelItems, map[string]interface{}{
+				"id":   channel.Id,
+				"name": channel.Name,
+			})
+			usingPackage[channel.Id] = true
+		}
+	}
+
+	groupItems := []map[string]interface{}{}
+	total := 0
+	for _, group := range groups {
+		if !usingPackage[group.ChannelID] {
+			continue
+		}
+		instances, err := groupInstancesCount(ctx, c, appID, group.Id)
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't count the active instances of group %q", group.Name), err, errorAttrs{})}
+		}
+		groupItems = append(groupItems, map[string]interface{}{
+			"id":                     group.Id,
+			"name":                   group.Name,
+			"channel_id":             group.ChannelID,
+			"policy_updates_enabled": group.PolicyUpdatesEnabled,
+			"instances":              instances,
+		})
+		total += instances
+	}
+
+	d.SetId(nebraskaPackage.Id)
+	d.Set("package_id", nebraskaPackage.Id)
+	d.Set("version", nebraskaPackage.Version)
+	d.Set("arch", api.Arch(nebraskaPackage.Arch).String())
+	d.Set("channels", channelItems)
+	d.Set("groups", groupItems)
+	d.Set("instances", total)
+	return nil
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestPackageUsage(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{
+		{Id: "pkg-1", Version: "3510.2.1", Arch: 1},
+		{Id: "pkg-2", Version: "3510.2.1", Arch: 2},
+	}
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: "pkg-1"},
+		{Id: "ch-lts", Name: "lts", Arch: 1, PackageID: "pkg-1"},
+		{Id: "ch-arm", Name: "stable-arm", Arch: 2, PackageID: "pkg-2"},
+	}
+	fake.groups[testAppID] = []codegen.Group{
+		{Id: "grp-prod", Name: "prod", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+		{Id: "grp-lts", Name: "lts", ChannelID: "ch-lts"},
+		{Id: "grp-arm", Name: "arm", ChannelID: "ch-arm", PolicyUpdatesEnabled: true},
+	}
+	fake.instances["grp-prod"] = 1200
+	fake.instances["grp-lts"] = 40
+	fake.instances["grp-arm"] = 7
+	c := newFakeClient(t, server, nil)
+
+	d := schema.TestResourceDataRaw(t, dataSourcePackageUsage().Schema, map[string]interface{}{
+		"application_id": "io.kinvolk.demo",
+		"version":        "3510.2.1",
+		"arch":           "amd64",
+	})
+	if diags := dataSourcePackageUsageRead(context.Background(), d, c); diags.HasError() {
+		t.Fatalf("read failed: %#v", diags)
+	}
+	if d.Id() != "pkg-1" || d.Get("package_id") != "pkg-1" || d.Get("instances") != 1240 {
+		t.Errorf("unexpected usage %v %v %v", d.Id(), d.Get("package_id"), d.Get("instances"))
+	}
+	if channels := d.Get("channels").([]interface{}); len(channels) != 2 || channels[1].(map[string]interface{})["name"] != "lts" {
+		t.Errorf("unexpected channels %#v", channels)
+	}
+	groups := d.Get("groups").([]interface{})
+	if len(groups) != 2 {
+		t.Fatalf("unexpected groups %#v", groups)
+	}
+	if lts := groups[1].(map[string]interface{}); lts["id"] != "grp-lts" || lts["instances"] != 40 || lts["policy_updates_enabled"] != false {
+		t.Errorf("unexpected group %#v", lts)
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourcePackageUsage().Schema, map[string]interface{}{
+		"application_id": testAppID,
+		"package_id":     "pkg-2",
+	})
+	if diags := dataSourcePackageUsageRead(context.Background(), d, c); diags.HasError() {
+		t.Fatalf("read failed: %#v", diags)
+	}
+	if d.Get("version") != "3510.2.1" || d.Get("arch") != "aarch64" || d.Get("instances") != 7 {
+		t.Errorf("unexpected usage %v %v %v", d.Get("version"), d.Get("arch"), d.Get("instances"))
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourcePackageUsage().Schema, map[string]interface{}{
+		"application_id": testAppID,
+		"package_id":     "pkg-gone",
+	})
+	if diags := dataSourcePackageUsageRead(context.Background(), d, c); !diags.HasError() || diags[0].Summary != "Package not found" {
+		t.Errorf("unexpected diagnostics %#v", diags)
+	}
+}
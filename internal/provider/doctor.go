@@ -0,0 +1,291 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// doctorTimeout bounds each network check of Doctor.
+const doctorTimeout = 10 * time.Second
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "PASS"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "SKIP"
+)
+
+// checkResult is the outcome of a single Doctor check.
+type checkResult struct {
+	Name   string
+	Status checkStatus
+	Detail string
+	// Hint suggests how to fix a failed check.
+	Hint string
+}
+
+// Doctor checks, step by step, that the provider can reach and authenticate
+// against the Nebraska server configured by config and writes a report of the
+// checks to w. It returns whether all the checks passed.
+func Doctor(ctx context.Context, version string, config map[string]interface{}, w io.Writer) bool {
+	results := runDoctorChecks(ctx, version, config)
+	passed := true
+	for _, result := range results {
+		fmt.Fprintf(w, "[%s] %s", result.Status, result.Name)
+		if result.Detail != "" {
+			fmt.Fprintf(w, ": %s", result.Detail)
+		}
+		fmt.Fprintln(w)
+		if result.Hint != "" {
+			fmt.Fprintf(w, "       hint: %s\n", result.Hint)
+		}
+		if result.Status == checkFail {
+			passed = false
+		}
+	}
+	return passed
+}
+
+func runDoctorChecks(ctx context.Context, version string, config map[string]interface{}) []checkResult {
+	settings := providerSettings(version, config)
+	endpoint := settings["endpoint"].(string)
+	authMode := settings["auth_mode"].(string)
+
+	results := []checkResult{}
+	skipRest := func(names ...string) []checkResult {
+		for _, name := range names {
+			results = append(results, checkResult{Name: name, Status: checkSkip, Detail: "a previous check failed"})
+		}
+		return results
+	}
+	remaining := []string{"DNS", "Connection", "Server config", "Auth mode", "Authentication", "List applications"}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		results = append(results, checkResult{
+			Name:   "Endpoint",
+			Status: checkFail,
+			Detail: fmt.Sprintf("%q isn't a valid URL", endpoint),
+			Hint:   "set `endpoint` or NEBRASKA_ENDPOINT to the address of the Nebraska server, e.g. https://nebraska.example.com",
+		})
+		return skipRest(remaining...)
+	}
+	results = append(results, checkResult{Name: "Endpoint", Status: checkPass, Detail: endpoint})
+
+	// DNS
+	host := endpointURL.Hostname()
+	dnsCtx, cancel := context.WithTimeout(ctx, doctorTimeout)
+	addrs, err := net.DefaultResolver.LookupHost(dnsCtx, host)
+	cancel()
+	if err != nil {
+		results = append(results, checkResult{
+			Name:   "DNS",
+			Status: checkFail,
+			Detail: err.Error(),
+			Hint:   fmt.Sprintf("check the spelling of %q and that this machine's DNS resolver can resolve it", host),
+		})
+		return skipRest(remaining[1:]...)
+	}
+	results = append(results, checkResult{Name: "DNS", Status: checkPass, Detail: fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", "))})
+
+	// TCP and TLS
+	results = append(results, checkConnection(ctx, endpointURL))
+	if results[len(results)-1].Status == checkFail {
+		return skipRest(remaining[2:]...)
+	}
+
+	client, err := codegen.NewClientWithResponses(endpoint, codegen.WithHTTPClient(&http.Client{Timeout: doctorTimeout}))
+	if err != nil {
+		results = append(results, checkResult{Name: "Server config", Status: checkFail, Detail: err.Error()})
+		return skipRest(remaining[3:]...)
+	}
+
+	// server config
+	var authEditors []codegen.RequestEditorFn
+	if authMode == "github" && settings["github_token"].(string) != "" {
+		authEditors = append(authEditors, newBearerTokenRequestEditor(settings["github_token"].(string)))
+	}
+	configResp, err := client.GetConfigWithResponse(ctx, authEditors...)
+	if err != nil {
+		results = append(results, checkResult{
+			Name:   "Server config",
+			Status: checkFail,
+			Detail: err.Error(),
+			Hint:   "the endpoint accepted the connection but the request failed, check that it points at the Nebraska server and not at a proxy",
+		})
+		return skipRest(remaining[3:]...)
+	}
+	if configResp.JSON200 == nil {
+		results = append(results, checkResult{
+			Name:   "Server config",
+			Status: checkFail,
+			Detail: fmt.Sprintf("GET /config answered %d %s", configResp.StatusCode(), truncate(string(configResp.Body), 200)),
+			Hint:   "the endpoint doesn't look like a Nebraska server, check the URL and any path prefix",
+		})
+		return skipRest(remaining[3:]...)
+	}
+	serverConfig := configResp.JSON200
+	detail := fmt.Sprintf("auth_mode %q", serverConfig.AuthMode)
+	if serverConfig.NebraskaVersion != "" {
+		detail = fmt.Sprintf("Nebraska %s, %s", serverConfig.NebraskaVersion, detail)
+	}
+	results = append(results, checkResult{Name: "Server config", Status: checkPass, Detail: detail})
+
+	// auth mode
+	if serverConfig.AuthMode != authMode {
+		results = append(results, checkResult{
+			Name:   "Auth mode",
+			Status: checkFail,
+			Detail: fmt.Sprintf("the provider uses %q but the server uses %q", authMode, serverConfig.AuthMode),
+			Hint:   fmt.Sprintf("set `auth_mode` or NEBRASKA_AUTH_MODE to %q", serverConfig.AuthMode),
+		})
+		return skipRest(remaining[4:]...)
+	}
+	results = append(results, checkResult{Name: "Auth mode", Status: checkPass, Detail: authMode})
+
+	// authentication
+	switch authMode {
+	case "noop":
+		results = append(results, checkResult{Name: "Authentication", Status: checkPass, Detail: "not required by the noop auth mode"})
+	case "github":
+		if settings["github_token"].(string) == "" {
+			results = append(results, checkResult{
+				Name:   "Authentication",
+				Status: checkFail,
+				Detail: "no github_token configured",
+				Hint:   "set `github_token` or NEBRASKA_GH_TOKEN to a GitHub token of a member of the Nebraska teams",
+			})
+			return skipRest(remaining[5:]...)
+		}
+		results = append(results, checkResult{Name: "Authentication", Status: checkPass, Detail: "using the configured github_token"})
+	case "oidc":
+		username, password := settings["username"].(string), settings["password"].(string)
+		if username == "" || password == "" {
+			results = append(results, checkResult{
+				Name:   "Authentication",
+				Status: checkFail,
+				Detail: "username or password not configured",
+				Hint:   "set `username` and `password` or NEBRASKA_USERNAME and NEBRASKA_PASSWORD",
+			})
+			return skipRest(remaining[5:]...)
+		}
+		authEditors, err = loginOIDC(ctx, client, username, password)
+		if err != nil {
+			results = append(results, checkResult{
+				Name:   "Authentication",
+				Status: checkFail,
+				Detail: err.Error(),
+				Hint:   "check the credentials and that the OIDC provider allows the password grant for the Nebraska client",
+			})
+			return skipRest(remaining[5:]...)
+		}
+		results = append(results, checkResult{Name: "Authentication", Status: checkPass, Detail: fmt.Sprintf("logged in as %q", username)})
+	}
+
+	// read-only list call
+	page, perPage := 1, 1
+	appsResp, err := client.PaginateAppsWithResponse(ctx, &codegen.PaginateAppsParams{Page: &page, Perpage: &perPage}, authEditors...)
+	switch {
+	case err != nil:
+		results = append(results, checkResult{Name: "List applications", Status: checkFail, Detail: err.Error()})
+	case appsResp.JSON200 == nil:
+		hint := "the server rejected the request, check its logs"
+		if code := appsResp.StatusCode(); code == http.StatusUnauthorized || code == http.StatusForbidden {
+			hint = "the credentials were rejected, check that the token hasn't expired and the user belongs to the Nebraska read or admin team"
+		}
+		results = append(results, checkResult{
+			Name:   "List applications",
+			Status: checkFail,
+			Detail: fmt.Sprintf("GET /api/apps answered %d %s", appsResp.StatusCode(), truncate(string(appsResp.Body), 200)),
+			Hint:   hint,
+		})
+	default:
+		results = append(results, checkResult{Name: "List applications", Status: checkPass, Detail: fmt.Sprintf("%d applications visible", appsResp.JSON200.TotalCount)})
+	}
+	return results
+}
+
+// checkConnection checks that the endpoint accepts TCP connections and, for
+// https endpoints, completes a TLS handshake.
+func checkConnection(ctx context.Context, endpointURL *url.URL) checkResult {
+	address := endpointURL.Host
+	if endpointURL.Port() == "" {
+		port := "80"
+		if endpointURL.Scheme == "https" {
+			port = "443"
+		}
+		address = net.JoinHostPort(endpointURL.Hostname(), port)
+	}
+
+	dialer := &net.Dialer{Timeout: doctorTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return checkResult{
+			Name:   "Connection",
+			Status: checkFail,
+			Detail: err.Error(),
+			Hint:   fmt.Sprintf("check that the server listens on %s and that no firewall or proxy blocks it", address),
+		}
+	}
+	defer conn.Close()
+
+	if endpointURL.Scheme != "https" {
+		return checkResult{Name: "Connection", Status: checkPass, Detail: fmt.Sprintf("connected to %s (plain HTTP)", address)}
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: endpointURL.Hostname()})
+	tlsConn.SetDeadline(time.Now().Add(doctorTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return checkResult{
+			Name:   "Connection",
+			Status: checkFail,
+			Detail: fmt.Sprintf("TLS handshake with %s failed: %v", address, err),
+			Hint:   "check that the certificate is valid for the host name and signed by a CA trusted by this machine",
+		}
+	}
+	state := tlsConn.ConnectionState()
+	detail := fmt.Sprintf("TLS to %s", address)
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		detail = fmt.Sprintf("%s, certificate for %q expires %s", detail, cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+	}
+	return checkResult{Name: "Connection", Status: checkPass, Detail: detail}
+}
+
+// providerSettings returns the string provider arguments from config, falling
+// back to their environment variables and defaults.
+func providerSettings(version string, config map[string]interface{}) map[string]interface{} {
+	p := New(version)()
+	settings := map[string]interface{}{}
+	for _, key := range []string{"endpoint", "auth_mode", "github_token", "username", "password"} {
+		if v, ok := config[key]; ok {
+			settings[key] = v
+			continue
+		}
+		settings[key] = ""
+		if s := p.Schema[key]; s.DefaultFunc != nil {
+			if v, err := s.DefaultFunc(); err == nil && v != nil {
+				settings[key] = v
+			}
+		}
+	}
+	return settings
+}
+
+func truncate(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
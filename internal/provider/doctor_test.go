@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	_, server := newFakeNebraska(t)
+
+	var out bytes.Buffer
+	ok := Doctor(context.Background(), "test", map[string]interface{}{"endpoint": server.URL, "auth_mode": "noop"}, &out)
+	if !ok {
+		t.Fatalf("doctor failed:\n%s", out.String())
+	}
+	for _, check := range []string{"Endpoint", "DNS", "Connection", "Server config", "Auth mode", "Authentication", "List applications"} {
+		if !strings.Contains(out.String(), "[PASS] "+check) {
+			t.Errorf("check %q didn't pass:\n%s", check, out.String())
+		}
+	}
+}
+
+func TestDoctorAuthModeMismatch(t *testing.T) {
+	fake, server := newFakeNebraska(t)
+	fake.authMode = "github"
+
+	var out bytes.Buffer
+	ok := Doctor(context.Background(), "test", map[string]interface{}{"endpoint": server.URL, "auth_mode": "noop"}, &out)
+	if ok {
+		t.Fatalf("doctor passed with mismatched auth modes:\n%s", out.String())
+	}
+	for _, want := range []string{
+		"[FAIL] Auth mode",
+		`hint: set ` + "`auth_mode`" + ` or NEBRASKA_AUTH_MODE to "github"`,
+		"[SKIP] Authentication",
+		"[SKIP] List applications",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report doesn't contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDoctorInvalidEndpoint(t *testing.T) {
+	var out bytes.Buffer
+	if Doctor(context.Background(), "test", map[string]interface{}{"endpoint": "nebraska", "auth_mode": "noop"}, &out) {
+		t.Fatalf("doctor passed with an invalid endpoint:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "[FAIL] Endpoint") || !strings.Contains(out.String(), "[SKIP] DNS") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
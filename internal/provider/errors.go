@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// apiError is a response of the Nebraska API with an unexpected status code or
+// body.
+type apiError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the message of Nebraska's error payload, empty when the
+	// response has none.
+	Message string
+	Body    string
+}
+
+// newAPIError returns the error for the unexpected response resp, body is the
+// already read response body.
+func newAPIError(resp *http.Response, body []byte) error {
+	e := &apiError{Body: strings.TrimSpace(string(body))}
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+		if resp.Request != nil {
+			e.Method = resp.Request.Method
+			e.Path = resp.Request.URL.Path
+		}
+	}
+	var payload struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		e.Message = payload.Message
+	}
+	return e
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Body
+	}
+	s := fmt.Sprintf("%s %s: got response code %d", e.Method, e.Path, e.StatusCode)
+	if msg != "" {
+		s = fmt.Sprintf("%s: %s", s, msg)
+	}
+	return s
+}
+
+// appNotFound reports whether Nebraska couldn't find the application of the
+// request, which it answers with a 400.
+func (e *apiError) appNotFound() bool {
+	return e.StatusCode == http.StatusBadRequest && strings.HasPrefix(e.Message, "App not found")
+}
+
+// isNotFound reports whether err is an API error for an object that doesn't
+// exist.
+func isNotFound(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.appNotFound()
+}
+
+// errorAttrs name the attributes the diagnostics of a failed API call point
+// at, empty names don't apply to the resource.
+type errorAttrs struct {
+	// application is the attribute referencing the application.
+	application string
+	// unique is the attribute whose value must be unique, e.g. product_id.
+	unique string
+}
+
+// apiErrorDiag turns the error of the API call made by step into a diagnostic
+// explaining the failure and how to fix it.
+func apiErrorDiag(step string, err error, attrs errorAttrs) diag.Diagnostic {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  step,
+			Detail:   fmt.Sprintf("%v\n\nRun `terraform-provider-nebraska doctor` to check the connection to the Nebraska server.", err),
+		}
+	}
+
+	d := diag.Diagnostic{Severity: diag.Error}
+	var summary, hint, attr string
+	switch code := apiErr.StatusCode; {
+	case apiErr.appNotFound():
+		summary = "application not found"
+		hint = "Check that the application ID or product ID exists and is visible to the authenticated user."
+		attr = attrs.application
+	case code == http.StatusBadRequest:
+		summary = "invalid request"
+		hint = "The Nebraska server rejected the request, check the values of the arguments."
+	case code == http.StatusUnauthorized:
+		summary = "token expired or invalid"
+		hint = "The Nebraska server didn't accept the credentials. Check that github_token is valid, or for the oidc auth_mode that username and password are correct and the login token hasn't expired."
+	case code == http.StatusForbidden:
+		summary = "permission denied"
+		hint = "The authenticated user isn't allowed to do this, changes require a member of the Nebraska admin team."
+	case code == http.StatusNotFound:
+		summary = "not found"
+		hint = "The object doesn't exist, it may have been deleted outside of Terraform."
+	case code == http.StatusConflict:
+		summary = "conflict"
+		hint = "The object conflicts with an existing one."
+		if attrs.unique != "" {
+			summary = fmt.Sprintf("%s already exists", attrs.unique)
+			hint = fmt.Sprintf("Another object already uses this %s, choose a different one or import the existing object.", attrs.unique)
+			attr = attrs.unique
+		}
+	case code >= 500:
+		summary = "Nebraska server error"
+		hint = "The Nebraska server failed to handle the request, check its logs and retry later."
+		if attrs.unique != "" {
+			hint += fmt.Sprintf(" Nebraska also fails this way when the %s is already used by another object.", attrs.unique)
+		}
+	case code >= 200 && code < 300:
+		summary = "unexpected response"
+		hint = "The Nebraska server answered with a body the provider couldn't decode, check that the endpoint points at a compatible Nebraska server."
+	default:
+		summary = "unexpected response"
+		hint = "The Nebraska server answered with an unexpected status code."
+	}
+
+	d.Summary = fmt.Sprintf("%s: %s", step, summary)
+	d.Detail = fmt.Sprintf("%s\n\n%v", hint, err)
+	if attr != "" {
+		d.AttributePath = cty.GetAttrPath(attr)
+	}
+	return d
+}
+
+// deleteErr returns the error of a delete call, objects that are already gone
+// count as deleted. Nebraska answers the deletion of most missing objects with
+// a 500 rather than a 404, so server errors are double checked with get.
+func deleteErr(err error, get func() error) error {
+	if err == nil || isNotFound(err) {
+		return nil
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 500 && isNotFound(get()) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+)
+
+func TestNewAPIError(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusBadRequest,
+		Request:    &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/api/apps/io.example.App"}},
+	}
+	err := newAPIError(resp, []byte(`{"message":"App not found for :io.example.App"}`))
+	want := "GET /api/apps/io.example.App: got response code 400: App not found for :io.example.App"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	if !isNotFound(fmt.Errorf("wrapped: %w", err)) {
+		t.Errorf("app not found error isn't reported as not found")
+	}
+	if isNotFound(errors.New("connection refused")) {
+		t.Errorf("request error is reported as not found")
+	}
+}
+
+func TestAPIErrorDiag(t *testing.T) {
+	attrs := errorAttrs{application: "application_id", unique: "product_id"}
+	cases := []struct {
+		status  int
+		body    string
+		summary string
+		path    cty.Path
+	}{
+		{http.StatusBadRequest, `{"message":"App not found for :x"}`, "step: application not found", cty.GetAttrPath("application_id")},
+		{http.StatusBadRequest, "", "step: invalid request", nil},
+		{http.StatusUnauthorized, "", "step: token expired or invalid", nil},
+		{http.StatusForbidden, "", "step: permission denied", nil},
+		{http.StatusNotFound, `{"message":"Not Found"}`, "step: not found", nil},
+		{http.StatusConflict, "", "step: product_id already exists", cty.GetAttrPath("product_id")},
+		{http.StatusInternalServerError, "", "step: Nebraska server error", nil},
+		{http.StatusOK, "<html>", "step: unexpected response", nil},
+	}
+	for _, tc := range cases {
+		err := newAPIError(&http.Response{StatusCode: tc.status}, []byte(tc.body))
+		d := apiErrorDiag("step", err, attrs)
+		if d.Summary != tc.summary {
+			t.Errorf("%d %s: got summary %q, want %q", tc.status, tc.body, d.Summary, tc.summary)
+		}
+		if !d.AttributePath.Equals(tc.path) {
+			t.Errorf("%d %s: got path %#v, want %#v", tc.status, tc.body, d.AttributePath, tc.path)
+		}
+	}
+
+	d := apiErrorDiag("step", errors.New("connection refused"), attrs)
+	if d.Summary != "step" || d.AttributePath != nil {
+		t.Errorf("unexpected diagnostic for a request error: %#v", d)
+	}
+}
@@ -0,0 +1,317 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// ProviderConfig holds the provider arguments, the ones left unset fall
+	// back to their environment variables and defaults as in a provider block.
+	ProviderConfig map[string]interface{}
+	// OutputDir is the directory the .tf files are written to.
+	OutputDir string
+	// Applications restricts the export to these application IDs or product
+	// IDs, all the applications are exported when empty.
+	Applications []string
+}
+
+// Export writes the Terraform configuration of the applications of a Nebraska
+// server, with their channels, groups and packages, into one .tf file per
+// application. Every resource comes with an import block so that a plan
+// adopts the existing objects.
+func Export(ctx context.Context, version string, opts ExportOptions) error {
+	c, err := configureClient(ctx, version, opts.ProviderConfig)
+	if err != nil {
+		return err
+	}
+
+	apps, err := c.listApplications(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't list applications: %v", err)
+	}
+	if len(opts.Applications) > 0 {
+		apps, err = filterApplications(ctx, c, apps, opts.Applications)
+		if err != nil {
+			return err
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].ProductId < apps[j].ProductId })
+
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return err
+	}
+
+	names := exportNames{}
+	for _, app := range apps {
+		file, err := exportApplication(ctx, c, app, names)
+		if err != nil {
+			return fmt.Errorf("couldn't export application %q: %v", app.Name, err)
+		}
+		filename := filepath.Join(opts.OutputDir, exportFilename(app)+".tf")
+		content := bytes.TrimRight(hclwrite.Format(file.Bytes()), "\n")
+		if err := ioutil.WriteFile(filename, append(content, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureClient configures the provider outside of Terraform and returns its
+// client.
+func configureClient(ctx context.Context, version string, config map[string]interface{}) (*apiClient, error) {
+	p := New(version)()
+	rawConfig := terraform.NewResourceConfigRaw(config)
+	diags := p.Validate(rawConfig)
+	if !diags.HasError() {
+		diags = append(diags, p.Configure(ctx, rawConfig)...)
+	}
+	if diags.HasError() {
+		return nil, diagsToError(diags)
+	}
+	return p.Meta().(*apiClient), nil
+}
+
+func diagsToError(diags diag.Diagnostics) error {
+	msgs := []string{}
+	for _, d := range diags {
+		if d.Severity != diag.Error {
+			continue
+		}
+		msg := d.Summary
+		if d.Detail != "" {
+			msg += ": " + d.Detail
+		}
+		msgs = append(msgs, msg)
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+func filterApplications(ctx context.Context, c *apiClient, apps []codegen.Application, refs []string) ([]codegen.Application, error) {
+	wanted := map[string]bool{}
+	for _, ref := range refs {
+		appID, err := c.resolveApplicationID(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		wanted[appID] = true
+	}
+
+	filtered := []codegen.Application{}
+	for _, app := range apps {
+		if wanted[app.Id] {
+			filtered = append(filtered, app)
+		}
+	}
+	return filtered, nil
+}
+
+func exportApplication(ctx context.Context, c *apiClient, app codegen.Application, names exportNames) (*hclwrite.File, error) {
+	channels, err := c.listChannels(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := c.listGroups(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := c.listPackages(ctx, app.Id)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Name+"/"+api.Arch(channels[i].Arch).String() < channels[j].Name+"/"+api.Arch(channels[j].Arch).String()
+	})
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	sort.Slice(packages, func(i, j int) bool {
+		return packages[i].Version+"/"+api.Arch(packages[i].Arch).String() < packages[j].Version+"/"+api.Arch(packages[j].Arch).String()
+	})
+
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+
+	appName := names.next("nebraska_application", app.ProductId)
+	appRef := appendAttr(exportReference("nebraska_application", appName), "id")
+	appBody := appendImportedResource(body, "nebraska_application", appName, app.Id)
+	appBody.SetAttributeValue("product_id", cty.StringVal(app.ProductId))
+	appBody.SetAttributeValue("name", cty.StringVal(app.Name))
+	setOptionalString(appBody, "description", app.Description)
+
+	// channels reference packages and groups reference channels, names are
+	// allocated before any block is written.
+	packageRefs := map[string]hcl.Traversal{}
+	packageNames := map[string]string{}
+	for _, p := range packages {
+		packageNames[p.Id] = names.next("nebraska_package", p.Version+"_"+api.Arch(p.Arch).String())
+		packageRefs[p.Id] = exportReference("nebraska_package", packageNames[p.Id])
+	}
+	channelRefs := map[string]hcl.Traversal{}
+	channelNames := map[string]string{}
+	for _, channel := range channels {
+		channelNames[channel.Id] = names.next("nebraska_channel", channel.Name+"_"+api.Arch(channel.Arch).String())
+		channelRefs[channel.Id] = exportReference("nebraska_channel", channelNames[channel.Id])
+	}
+
+	for _, p := range packages {
+		importID := app.Id + "/" + p.Id
+		pkgBody := appendImportedResource(body, "nebraska_package", packageNames[p.Id], importID)
+		pkgBody.SetAttributeTraversal("application_id", appRef)
+		pkgBody.SetAttributeValue("version", cty.StringVal(p.Version))
+		pkgBody.SetAttributeValue("arch", cty.StringVal(api.Arch(p.Arch).String()))
+
+		pkgURL := p.Url
+		if strings.Contains(p.Url, "nua_commit") || strings.Contains(p.Url, "nua_namespace") || strings.Contains(p.Url, "nua_kustomize_config") {
+			ghURL, commit, path, kustomize, err := decodeNUAURL(p.Url)
+			if err != nil {
+				return nil, err
+			}
+			pkgURL = ghURL
+			pkgBody.SetAttributeValue("type", cty.StringVal("git"))
+			pkgBody.SetAttributeValue("nua_commit", cty.StringVal(commit))
+			pkgBody.SetAttributeValue("nua_namespace", cty.StringVal(path))
+			pkgBody.SetAttributeValue("nua_kustomize_config", cty.StringVal(kustomize))
+		} else {
+			pkgBody.SetAttributeValue("type", cty.StringVal(PackageType(p.Type).String()))
+		}
+		pkgBody.SetAttributeValue("url", cty.StringVal(pkgURL))
+		pkgBody.SetAttributeValue("filename", cty.StringVal(p.Filename))
+		pkgBody.SetAttributeValue("description", cty.StringVal(p.Description))
+		pkgBody.SetAttributeValue("size", cty.StringVal(p.Size))
+		pkgBody.SetAttributeValue("hash", cty.StringVal(p.Hash))
+
+		if len(p.ChannelsBlacklist) > 0 {
+			// the blacklisted channels are referred to by name rather than
+			// by reference, channels already reference packages and a
+			// package blacklisted on one channel and used by another would
+			// make a cycle.
+			refs := []cty.Value{}
+			for _, ref := range channelsBlacklistRefs(channels, api.Arch(p.Arch).String(), p.ChannelsBlacklist, nil) {
+				refs = append(refs, cty.StringVal(ref))
+			}
+			pkgBody.SetAttributeValue("channels_blacklist", cty.ListVal(refs))
+		}
+		if p.FlatcarAction != nil && p.FlatcarAction.Sha256 != "" {
+			actionBody := pkgBody.AppendNewBlock("flatcar_action", nil).Body()
+			actionBody.SetAttributeValue("sha256", cty.StringVal(p.FlatcarAction.Sha256))
+		}
+	}
+
+	for _, channel := range channels {
+		importID := app.Id + "/" + channel.Id
+		channelBody := appendImportedResource(body, "nebraska_channel", channelNames[channel.Id], importID)
+		channelBody.SetAttributeTraversal("application_id", appRef)
+		channelBody.SetAttributeValue("name", cty.StringVal(channel.Name))
+		channelBody.SetAttributeValue("arch", cty.StringVal(api.Arch(channel.Arch).String()))
+		setOptionalString(channelBody, "color", channel.Color)
+		if ref, ok := packageRefs[channel.PackageID]; ok {
+			channelBody.SetAttributeTraversal("package_id", appendAttr(ref, "id"))
+		} else {
+			setOptionalString(channelBody, "package_id", channel.PackageID)
+		}
+	}
+
+	for _, group := range groups {
+		importID := app.Id + "/" + group.Id
+		groupBody := appendImportedResource(body, "nebraska_group", names.next("nebraska_group", group.Name), importID)
+		groupBody.SetAttributeTraversal("application_id", appRef)
+		groupBody.SetAttributeValue("name", cty.StringVal(group.Name))
+		setOptionalString(groupBody, "description", group.Description)
+		if ref, ok := channelRefs[group.ChannelID]; ok {
+			groupBody.SetAttributeTraversal("channel_id", appendAttr(ref, "id"))
+		} else {
+			setOptionalString(groupBody, "channel_id", group.ChannelID)
+		}
+		setOptionalString(groupBody, "track", group.Track)
+		groupBody.SetAttributeValue("policy_updates_enabled", cty.BoolVal(group.PolicyUpdatesEnabled))
+		groupBody.SetAttributeValue("policy_safe_mode", cty.BoolVal(group.PolicySafeMode))
+		groupBody.SetAttributeValue("policy_office_hours", cty.BoolVal(group.PolicyOfficeHours))
+		groupBody.SetAttributeValue("policy_timezone", cty.StringVal(group.PolicyTimezone))
+		groupBody.SetAttributeValue("policy_period_interval", cty.StringVal(group.PolicyPeriodInterval))
+		groupBody.SetAttributeValue("policy_max_updates_per_period", cty.NumberIntVal(int64(group.PolicyMaxUpdatesPerPeriod)))
+		groupBody.SetAttributeValue("policy_update_timeout", cty.StringVal(group.PolicyUpdateTimeout))
+	}
+
+	return file, nil
+}
+
+// appendImportedResource appends an import block and the resource block it
+// imports into, and returns the body of the resource block.
+func appendImportedResource(body *hclwrite.Body, resourceType, name, importID string) *hclwrite.Body {
+	importBody := body.AppendNewBlock("import", nil).Body()
+	importBody.SetAttributeTraversal("to", exportReference(resourceType, name))
+	importBody.SetAttributeValue("id", cty.StringVal(importID))
+	body.AppendNewline()
+
+	resourceBody := body.AppendNewBlock("resource", []string{resourceType, name}).Body()
+	body.AppendNewline()
+	return resourceBody
+}
+
+func setOptionalString(body *hclwrite.Body, name, value string) {
+	if value != "" {
+		body.SetAttributeValue(name, cty.StringVal(value))
+	}
+}
+
+func exportReference(resourceType, name string) hcl.Traversal {
+	return hcl.Traversal{
+		hcl.TraverseRoot{Name: resourceType},
+		hcl.TraverseAttr{Name: name},
+	}
+}
+
+func appendAttr(traversal hcl.Traversal, name string) hcl.Traversal {
+	ref := append(hcl.Traversal{}, traversal...)
+	return append(ref, hcl.TraverseAttr{Name: name})
+}
+
+var exportNameReplacer = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// exportName turns a Nebraska name into a Terraform identifier.
+func exportName(name string) string {
+	id := strings.Trim(exportNameReplacer.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "r_" + id
+	}
+	return id
+}
+
+func exportFilename(app codegen.Application) string {
+	if app.ProductId != "" {
+		return exportName(app.ProductId)
+	}
+	return exportName(app.Name)
+}
+
+// exportNames allocates unique resource names per resource type.
+type exportNames map[string]map[string]bool
+
+func (n exportNames) next(resourceType, name string) string {
+	if n[resourceType] == nil {
+		n[resourceType] = map[string]bool{}
+	}
+	base := exportName(name)
+	id := base
+	for i := 2; n[resourceType][id]; i++ {
+		id = fmt.Sprintf("%s_%d", base, i)
+	}
+	n[resourceType][id] = true
+	return id
+}
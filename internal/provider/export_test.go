@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestExport(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{{
+		Id: "pkg-1", Version: "3510.2.1", Arch: 1, Type: 1, Url: "https://example.com/", Filename: "update.gz", Size: "10", Hash: "aGFzaA==",
+		ChannelsBlacklist: []string{"ch-beta", "ch-gone"},
+		FlatcarAction:     &codegen.FlatcarAction{Sha256: "c2hh"},
+	}}
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: "pkg-1"},
+		{Id: "ch-beta", Name: "beta", Arch: 1},
+	}
+	fake.groups[testAppID] = []codegen.Group{{Id: "grp-1", Name: "Prod EU", ChannelID: "ch-stable", PolicyTimezone: "Europe/Berlin"}}
+
+	dir := t.TempDir()
+	err := Export(context.Background(), "test", ExportOptions{
+		ProviderConfig: map[string]interface{}{"endpoint": server.URL, "auth_mode": "noop"},
+		OutputDir:      dir,
+	})
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "io_kinvolk_demo.tf"))
+	if err != nil {
+		t.Fatalf("couldn't read export: %v", err)
+	}
+	for _, want := range []string{
+		`to = nebraska_application.io_kinvolk_demo`,
+		`id = "` + testAppID + `/ch-stable"`,
+		`resource "nebraska_channel" "stable_amd64"`,
+		`package_id     = nebraska_package.r_3510_2_1_amd64.id`,
+		`channels_blacklist = ["beta", "ch-gone"]`,
+		`channel_id                    = nebraska_channel.stable_amd64.id`,
+		`resource "nebraska_group" "prod_eu"`,
+		`application_id                = nebraska_application.io_kinvolk_demo.id`,
+		`sha256 = "c2hh"`,
+		`type               = "flatcar"`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("export doesn't contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExportNames(t *testing.T) {
+	names := exportNames{}
+	cases := []struct{ name, want string }{
+		{"stable", "stable"},
+		{"Stable", "stable_2"},
+		{"3510.2.1 amd64", "r_3510_2_1_amd64"},
+		{"---", "r_"},
+	}
+	for _, tc := range cases {
+		if got := names.next("nebraska_channel", tc.name); got != tc.want {
+			t.Errorf("next(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// fakeNebraska is an in-memory stand-in for the parts of the Nebraska API the
+// provider uses.
+type fakeNebraska struct {
+	mu       sync.Mutex
+	authMode string
+	apps     []codegen.Application
+	channels map[string][]codegen.Channel
+	groups   map[string][]codegen.Group
+	packages map[string][]codegen.Package
+	// instances is the instance count of each group.
+	instances map[string]uint64
+	// stats and versions are the instance stats and version breakdown of
+	// each group.
+	stats    map[string]codegen.GroupInstanceStats
+	versions map[string]codegen.GroupVersionBreakdown
+	// nextID numbers the created objects.
+	nextID int
+}
+
+func newFakeNebraska(t *testing.T) (*fakeNebraska, *httptest.Server) {
+	f := &fakeNebraska{
+		authMode:  "noop",
+		channels:  map[string][]codegen.Channel{},
+		groups:    map[string][]codegen.Group{},
+		packages:  map[string][]codegen.Package{},
+		instances: map[string]uint64{},
+		stats:     map[string]codegen.GroupInstanceStats{},
+		versions:  map[string]codegen.GroupVersionBreakdown{},
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// testAppID is the ID of the demo application newDemoNebraska seeds, its
+// product ID is io.kinvolk.demo.
+const testAppID = "6d3aee69-2fa4-4ff6-bf4d-5aee9b3a7fd3"
+
+// newDemoNebraska returns a fake server seeded with the demo application.
+func newDemoNebraska(t *testing.T) (*fakeNebraska, *httptest.Server) {
+	f, server := newFakeNebraska(t)
+	f.apps = []codegen.Application{{Id: testAppID, ProductId: "io.kinvolk.demo", Name: "Demo"}}
+	return f, server
+}
+
+// newFakeClient returns a client configured against the fake server.
+func newFakeClient(t *testing.T, server *httptest.Server, config map[string]interface{}) *apiClient {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	config["endpoint"] = server.URL
+	if _, ok := config["auth_mode"]; !ok {
+		config["auth_mode"] = "noop"
+	}
+	c, err := configureClient(context.Background(), "test", config)
+	if err != nil {
+		t.Fatalf("couldn't configure client: %v", err)
+	}
+	return c
+}
+
+func (f *fakeNebraska) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/config":
+		writeJSON(w, codegen.Config{AuthMode: f.authMode})
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "apps" && r.Method == http.MethodPost:
+		f.createApp(w, r)
+	case len(parts) == 2 && parts[0] == "api" && parts[1] == "apps":
+		items := paginateItems(r, len(f.apps))
+		writeJSON(w, codegen.AppsPage{Applications: f.apps[items.start:items.end], Count: items.end - items.start, TotalCount: len(f.apps)})
+	case len(parts) >= 3 && parts[0] == "api" && parts[1] == "apps":
+		app := f.app(parts[2])
+		if app == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"message": "App not found for :" + parts[2]})
+			return
+		}
+		f.serveApp(w, r, app, parts[3:])
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// createApp creates an application, copying the channels and groups of the
+// clone_from application.
+func (f *fakeNebraska) createApp(w http.ResponseWriter, r *http.Request) {
+	var config codegen.AppConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil || config.ProductId == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.nextID++
+	app := codegen.Application{Id: fmt.Sprintf("app-created-%d", f.nextID), Name: config.Name, ProductId: *config.ProductId}
+	if config.Description != nil {
+		app.Description = *config.Description
+	}
+	if cloneFrom := r.URL.Query().Get("clone_from"); cloneFrom != "" {
+		source := f.app(cloneFrom)
+		if source == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		channelIDs := map[string]string{}
+		for _, channel := range f.channels[source.Id] {
+			f.nextID++
+			channelIDs[channel.Id] = fmt.Sprintf("ch-created-%d", f.nextID)
+			channel.Id = channelIDs[channel.Id]
+			channel.ApplicationID = app.Id
+			f.channels[app.Id] = append(f.channels[app.Id], channel)
+		}
+		for _, group := range f.groups[source.Id] {
+			f.nextID++
+			group.Id = fmt.Sprintf("grp-created-%d", f.nextID)
+			group.ApplicationID = app.Id
+			group.ChannelID = channelIDs[group.ChannelID]
+			f.groups[app.Id] = append(f.groups[app.Id], group)
+		}
+	}
+	f.apps = append(f.apps, app)
+	app.Channels = f.channels[app.Id]
+	app.Groups = f.groups[app.Id]
+	writeJSON(w, app)
+}
+
+func (f *fakeNebraska) serveApp(w http.ResponseWriter, r *http.Request, app *codegen.Application, parts []string) {
+	if len(parts) == 0 {
+		writeJSON(w, app)
+		return
+	}
+	switch parts[0] {
+	case "channels":
+		channels := f.channels[app.Id]
+		if len(parts) == 1 && r.Method == http.MethodPost {
+			var config codegen.ChannelConfig
+			if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.nextID++
+			channel := codegen.Channel{
+				Id:            fmt.Sprintf("ch-created-%d", f.nextID),
+				ApplicationID: app.Id,
+				Arch:          codegen.Arch(config.Arch),
+				Color:         config.Color,
+				Name:          config.Name,
+			}
+			if config.PackageId != nil {
+				channel.PackageID = *config.PackageId
+			}
+			f.channels[app.Id] = append(channels, channel)
+			writeJSON(w, channel)
+			return
+		}
+		if len(parts) == 1 {
+			items := paginateItems(r, len(channels))
+			writeJSON(w, codegen.ChannelPage{Channels: channels[items.start:items.end], TotalCount: len(channels)})
+			return
+		}
+		for i := range channels {
+			if channels[i].Id == parts[1] {
+				if r.Method == http.MethodPut {
+					// updates replace the package, an omitted package_id clears it.
+					channels[i].PackageID = ""
+				}
+				f.serveObject(w, r, &channels[i], func() {
+					f.channels[app.Id] = append(channels[:i:i], channels[i+1:]...)
+				})
+				return
+			}
+		}
+	case "groups":
+		groups := f.groups[app.Id]
+		if len(parts) == 1 {
+			items := paginateItems(r, len(groups))
+			writeJSON(w, codegen.GroupPage{Groups: groups[items.start:items.end], TotalCount: len(groups)})
+			return
+		}
+		for i := range groups {
+			if groups[i].Id != parts[1] {
+				continue
+			}
+			if len(parts) == 3 && parts[2] == "instancescount" {
+				writeJSON(w, codegen.InstanceCount{Count: f.instances[groups[i].Id]})
+				return
+			}
+			if len(parts) == 3 && parts[2] == "instances_stats" {
+				writeJSON(w, f.stats[groups[i].Id])
+				return
+			}
+			if len(parts) == 3 && parts[2] == "version_breakdown" {
+				versions := f.versions[groups[i].Id]
+				if versions == nil {
+					versions = codegen.GroupVersionBreakdown{}
+				}
+				writeJSON(w, versions)
+				return
+			}
+			f.serveObject(w, r, &groups[i], func() {
+				f.groups[app.Id] = append(groups[:i:i], groups[i+1:]...)
+			})
+			return
+		}
+	case "packages":
+		packages := f.packages[app.Id]
+		if len(parts) == 1 && r.Method == http.MethodPost {
+			var config codegen.PackageConfig
+			if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.nextID++
+			pkg := codegen.Package{
+				Id:                fmt.Sprintf("pkg-created-%d", f.nextID),
+				ApplicationID:     app.Id,
+				Arch:              codegen.Arch(config.Arch),
+				ChannelsBlacklist: config.ChannelsBlacklist,
+				Description:       config.Description,
+				Filename:          config.Filename,
+				Hash:              config.Hash,
+				Size:              config.Size,
+				Type:              config.Type,
+				Url:               config.Url,
+				Version:           config.Version,
+			}
+			if config.FlatcarAction != nil && config.FlatcarAction.Sha256 != nil {
+				pkg.FlatcarAction = &codegen.FlatcarAction{Sha256: *config.FlatcarAction.Sha256}
+			}
+			f.packages[app.Id] = append(packages, pkg)
+			writeJSON(w, pkg)
+			return
+		}
+		if len(parts) == 1 {
+			items := paginateItems(r, len(packages))
+			writeJSON(w, codegen.PackagePage{Packages: packages[items.start:items.end], TotalCount: len(packages)})
+			return
+		}
+		for i := range packages {
+			if packages[i].Id == parts[1] {
+				f.serveObject(w, r, &packages[i], func() {
+					// like Nebraska, clear the package of the channels using it.
+					for j := range f.channels[app.Id] {
+						if f.channels[app.Id][j].PackageID == packages[i].Id {
+							f.channels[app.Id][j].PackageID = ""
+						}
+					}
+					f.packages[app.Id] = append(packages[:i:i], packages[i+1:]...)
+				})
+				return
+			}
+		}
+	}
+	if r.Method == http.MethodDelete {
+		// like Nebraska, fail deleting missing objects with a server error.
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// serveObject serves a single object, updates are decoded into it.
+func (f *fakeNebraska) serveObject(w http.ResponseWriter, r *http.Request, object interface{}, remove func()) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, object)
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(object); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, object)
+	case http.MethodDelete:
+		remove()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeNebraska) app(ref string) *codegen.Application {
+	for i := range f.apps {
+		if f.apps[i].Id == ref || f.apps[i].ProductId == ref {
+			return &f.apps[i]
+		}
+	}
+	return nil
+}
+
+type itemRange struct{ start, end int }
+
+func paginateItems(r *http.Request, total int) itemRange {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("perpage"))
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 10
+	}
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	return itemRange{start, end}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,266 @@
+package provider
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// flatcarPayloadMagic starts every update_engine payload.
+const flatcarPayloadMagic = "CrAU"
+
+// maxPayloadMetadataSize bounds the manifest and metadata signature read from
+// a payload, real manifests are a few hundred kilobytes.
+const maxPayloadMetadataSize = 64 << 20
+
+// DeltaArchiveManifest and PartitionUpdate field numbers of update_engine's
+// update_metadata.proto telling delta payloads apart.
+const (
+	manifestOldKernelInfo     = 6
+	manifestOldRootfsInfo     = 8
+	manifestPartitions        = 13
+	partitionOldPartitionInfo = 6
+)
+
+// flatcarPayload is the metadata of a Flatcar (Chrome OS update_engine) update
+// payload, the values of the Omaha action Flatcar's update_engine checks.
+type flatcarPayload struct {
+	// Version is the payload format version, 1 or 2.
+	Version uint64
+	// ManifestSize is the size of the protobuf manifest.
+	ManifestSize uint64
+	// MetadataSize is the size of the header and the manifest, the
+	// metadata_size of the Omaha action.
+	MetadataSize uint64
+	// MetadataSignature is the RSA signature of the metadata, the
+	// metadata_signature_rsa of the Omaha action. Only version 2 payloads
+	// embed it.
+	MetadataSignature []byte
+	// IsDelta reports whether the payload applies on top of a previous
+	// version.
+	IsDelta bool
+}
+
+// parseFlatcarPayload parses the header, manifest and metadata signature of
+// the update_engine payload read from r. The payload may be gzip compressed.
+//
+// The header is the magic "CrAU", the big endian uint64 version and manifest
+// size and, from version 2, the uint32 size of the metadata signature. The
+// manifest and then the metadata signature follow.
+func parseFlatcarPayload(r io.Reader) (*flatcarPayload, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip stream: %v", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("payload header truncated: %v", err)
+	}
+	if string(header[:4]) != flatcarPayloadMagic {
+		return nil, fmt.Errorf("not an update payload, got magic %q instead of %q", header[:4], flatcarPayloadMagic)
+	}
+	p := &flatcarPayload{
+		Version:      binary.BigEndian.Uint64(header[4:12]),
+		ManifestSize: binary.BigEndian.Uint64(header[12:20]),
+	}
+	headerSize := uint64(len(header))
+	var signatureSize uint32
+	switch p.Version {
+	case 1:
+	case 2:
+		b := make([]byte, 4)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, fmt.Errorf("payload header truncated: %v", err)
+		}
+		signatureSize = binary.BigEndian.Uint32(b)
+		headerSize += 4
+	default:
+		return nil, fmt.Errorf("unsupported payload version %d", p.Version)
+	}
+	if p.ManifestSize > maxPayloadMetadataSize {
+		return nil, fmt.Errorf("payload manifest of %d bytes is too large", p.ManifestSize)
+	}
+	if signatureSize > maxPayloadMetadataSize {
+		return nil, fmt.Errorf("payload metadata signature of %d bytes is too large", signatureSize)
+	}
+	p.MetadataSize = headerSize + p.ManifestSize
+
+	manifest := make([]byte, p.ManifestSize)
+	if _, err := io.ReadFull(br, manifest); err != nil {
+		return nil, fmt.Errorf("payload manifest truncated: %v", err)
+	}
+	isDelta, err := manifestIsDelta(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload manifest: %v", err)
+	}
+	p.IsDelta = isDelta
+
+	if signatureSize > 0 {
+		signatures := make([]byte, signatureSize)
+		if _, err := io.ReadFull(br, signatures); err != nil {
+			return nil, fmt.Errorf("payload metadata signature truncated: %v", err)
+		}
+		signature, err := firstSignature(signatures)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload metadata signature: %v", err)
+		}
+		p.MetadataSignature = signature
+	}
+	return p, nil
+}
+
+// manifestIsDelta reports whether the DeltaArchiveManifest describes a delta
+// payload, that is whether it has the info of an old kernel, rootfs or
+// partition.
+func manifestIsDelta(manifest []byte) (bool, error) {
+	isDelta := false
+	err := walkProtobuf(manifest, func(field uint64, value []byte) error {
+		switch field {
+		case manifestOldKernelInfo, manifestOldRootfsInfo:
+			isDelta = true
+		case manifestPartitions:
+			return walkProtobuf(value, func(field uint64, _ []byte) error {
+				if field == partitionOldPartitionInfo {
+					isDelta = true
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return isDelta, err
+}
+
+// firstSignature returns the data of the first signature of a Signatures
+// message.
+func firstSignature(signatures []byte) ([]byte, error) {
+	var data []byte
+	err := walkProtobuf(signatures, func(field uint64, signature []byte) error {
+		if field != 1 || data != nil {
+			return nil
+		}
+		return walkProtobuf(signature, func(field uint64, value []byte) error {
+			// Signature.data
+			if field == 2 {
+				data = value
+			}
+			return nil
+		})
+	})
+	if err == nil && data == nil {
+		err = errors.New("no signature")
+	}
+	return data, err
+}
+
+// walkProtobuf calls fn with the field number and payload of the length
+// delimited fields of the protobuf message b, skipping the other wire types.
+func walkProtobuf(b []byte, fn func(field uint64, value []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("truncated field key")
+		}
+		b = b[n:]
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0: // varint
+			_, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("truncated varint")
+			}
+			b = b[n:]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			b = b[8:]
+		case 2: // length delimited
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errors.New("truncated length delimited field")
+			}
+			value := b[n : n+int(size)]
+			b = b[n+int(size):]
+			if err := fn(field, value); err != nil {
+				return err
+			}
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+// flatcarPayloadFile is a payload file and the digests nebraska_package
+// expects.
+type flatcarPayloadFile struct {
+	*flatcarPayload
+	Size int64
+	// SHA1 and SHA256 are the base64 encoded digests of the file, the hash
+	// and flatcar_action sha256 of nebraska_package.
+	SHA1   string
+	SHA256 string
+}
+
+// readFlatcarPayloadFile parses the payload file at path and digests it.
+func readFlatcarPayloadFile(path string) (*flatcarPayloadFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sha1Hash, sha256Hash := sha1.New(), sha256.New()
+	var size countingWriter
+	r := io.TeeReader(f, io.MultiWriter(sha1Hash, sha256Hash, &size))
+	payload, err := parseFlatcarPayload(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	// digest the rest of the file.
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	return &flatcarPayloadFile{
+		flatcarPayload: payload,
+		Size:           int64(size),
+		SHA1:           base64.StdEncoding.EncodeToString(sha1Hash.Sum(nil)),
+		SHA256:         base64.StdEncoding.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
+
+// metadataSignatureRSA returns the base64 encoded metadata signature, empty
+// when the payload has none.
+func (p *flatcarPayload) metadataSignatureRSA() string {
+	if len(p.MetadataSignature) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(p.MetadataSignature)
+}
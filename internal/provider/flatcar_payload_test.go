@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// uvarint encodes the varints v.
+func uvarint(v ...uint64) []byte {
+	var b []byte
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, x := range v {
+		b = append(b, buf[:binary.PutUvarint(buf, x)]...)
+	}
+	return b
+}
+
+// protobufField encodes a length delimited protobuf field.
+func protobufField(field uint64, value []byte) []byte {
+	return append(uvarint(field<<3|2, uint64(len(value))), value...)
+}
+
+// protobufVarint encodes a varint protobuf field.
+func protobufVarint(field uint64, value uint64) []byte {
+	return uvarint(field<<3, value)
+}
+
+// testPayload builds an update payload with manifest and, for version 2, the
+// metadata signature signature followed by a few bytes of data.
+func testPayload(version uint64, manifest []byte, signature []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("CrAU")
+	binary.Write(&b, binary.BigEndian, version)
+	binary.Write(&b, binary.BigEndian, uint64(len(manifest)))
+	var signatures []byte
+	if version == 2 {
+		if signature != nil {
+			signatures = protobufField(1, append(protobufVarint(1, 1), protobufField(2, signature)...))
+		}
+		binary.Write(&b, binary.BigEndian, uint32(len(signatures)))
+	}
+	b.Write(manifest)
+	b.Write(signatures)
+	b.WriteString("operations data")
+	return b.Bytes()
+}
+
+// fullManifest has the info of the new kernel and rootfs, and a block size.
+var fullManifest = bytes.Join([][]byte{
+	protobufVarint(3, 4096),
+	protobufField(7, protobufVarint(1, 1024)),
+	protobufField(9, protobufVarint(1, 2048)),
+}, nil)
+
+func TestParseFlatcarPayload(t *testing.T) {
+	deltaManifest := append(protobufField(8, protobufVarint(1, 2048)), fullManifest...)
+	partitionDeltaManifest := protobufField(13, bytes.Join([][]byte{
+		protobufField(1, []byte("root")),
+		protobufField(6, protobufVarint(1, 2048)),
+	}, nil))
+	partitionFullManifest := protobufField(13, bytes.Join([][]byte{
+		protobufField(1, []byte("root")),
+		protobufField(7, protobufVarint(1, 2048)),
+	}, nil))
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(testPayload(2, deltaManifest, []byte("signature")))
+	gz.Close()
+
+	cases := []struct {
+		name      string
+		payload   []byte
+		version   uint64
+		metadata  uint64
+		delta     bool
+		signature string
+	}{
+		{"v1 full", testPayload(1, fullManifest, nil), 1, 20 + uint64(len(fullManifest)), false, ""},
+		{"v1 delta", testPayload(1, deltaManifest, nil), 1, 20 + uint64(len(deltaManifest)), true, ""},
+		{"v2 signed", testPayload(2, fullManifest, []byte("signature")), 2, 24 + uint64(len(fullManifest)), false, "signature"},
+		{"v2 unsigned", testPayload(2, fullManifest, nil), 2, 24 + uint64(len(fullManifest)), false, ""},
+		{"v2 partition delta", testPayload(2, partitionDeltaManifest, nil), 2, 24 + uint64(len(partitionDeltaManifest)), true, ""},
+		{"v2 partition full", testPayload(2, partitionFullManifest, nil), 2, 24 + uint64(len(partitionFullManifest)), false, ""},
+		{"empty manifest", testPayload(1, nil, nil), 1, 20, false, ""},
+		{"gzip", gzipped.Bytes(), 2, 24 + uint64(len(deltaManifest)), true, "signature"},
+	}
+	for _, tc := range cases {
+		p, err := parseFlatcarPayload(bytes.NewReader(tc.payload))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if p.Version != tc.version || p.MetadataSize != tc.metadata || p.IsDelta != tc.delta || string(p.MetadataSignature) != tc.signature {
+			t.Errorf("%s: got %+v, want version %d, metadata size %d, delta %t, signature %q", tc.name, p, tc.version, tc.metadata, tc.delta, tc.signature)
+		}
+	}
+
+	largeManifest := testPayload(2, nil, nil)
+	binary.BigEndian.PutUint64(largeManifest[12:20], 1<<30)
+	largeSignature := testPayload(2, nil, nil)
+	binary.BigEndian.PutUint32(largeSignature[20:24], 1<<30)
+	errCases := []struct {
+		name    string
+		payload []byte
+		err     string
+	}{
+		{"empty", nil, "header truncated"},
+		{"magic", append([]byte("ELF!"), testPayload(1, nil, nil)[4:]...), "not an update payload"},
+		{"version", testPayload(3, nil, nil), "unsupported payload version 3"},
+		{"manifest truncated", testPayload(1, fullManifest, nil)[:25], "manifest truncated"},
+		{"manifest invalid", testPayload(1, []byte{0x0a, 0x05, 0x01}, nil), "invalid payload manifest"},
+		{"manifest too large", largeManifest, "manifest of 1073741824 bytes is too large"},
+		{"signature too large", largeSignature, "signature of 1073741824 bytes is too large"},
+		{"signature truncated", testPayload(2, fullManifest, []byte("signature"))[:24+len(fullManifest)+3], "signature truncated"},
+	}
+	for _, tc := range errCases {
+		_, err := parseFlatcarPayload(bytes.NewReader(tc.payload))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
+
+func TestDataSourceFlatcarPayload(t *testing.T) {
+	payload := testPayload(2, fullManifest, []byte("signature"))
+	path := filepath.Join(t.TempDir(), "update.gz")
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, dataSourceFlatcarPayload().Schema, map[string]interface{}{"path": path})
+	if diags := dataSourceFlatcarPayloadRead(context.Background(), d, nil); diags.HasError() {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	sum := sha256.Sum256(payload)
+	want := map[string]interface{}{
+		"id":                     base64.StdEncoding.EncodeToString(sum[:]),
+		"size":                   strconv.Itoa(len(payload)),
+		"is_delta":               false,
+		"metadata_size":          strconv.Itoa(24 + len(fullManifest)),
+		"metadata_signature_rsa": base64.StdEncoding.EncodeToString([]byte("signature")),
+		"payload_version":        2,
+	}
+	for key, value := range want {
+		if got := d.Get(key); got != value {
+			t.Errorf("got %s %#v, want %#v", key, got, value)
+		}
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceFlatcarPayload().Schema, map[string]interface{}{"path": filepath.Join(t.TempDir(), "missing")})
+	if diags := dataSourceFlatcarPayloadRead(context.Background(), d, nil); !diags.HasError() {
+		t.Errorf("reading a missing payload succeeded")
+	}
+}
+
+func TestPackageSourceFile(t *testing.T) {
+	deltaManifest := append(protobufField(6, protobufVarint(1, 1024)), fullManifest...)
+	payload := testPayload(1, deltaManifest, nil)
+	path := filepath.Join(t.TempDir(), "update.gz")
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resourcePackage()
+	attrs := map[string]interface{}{
+		"version":        "3510.2.1",
+		"url":            "https://update.release.flatcar-linux.net/amd64-usr/3510.2.1/",
+		"filename":       "update.gz",
+		"description":    "Flatcar 3510.2.1",
+		"application_id": testAppID,
+		"source_file":    path,
+	}
+	raw := map[string]cty.Value{}
+	for key, value := range attrs {
+		raw[key] = cty.StringVal(value.(string))
+	}
+	state := &terraform.InstanceState{RawConfig: rawConfig(r, raw)}
+	diff, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(attrs), &apiClient{})
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+
+	sum := sha256.Sum256(payload)
+	want := map[string]string{
+		"size":                                    strconv.Itoa(len(payload)),
+		"flatcar_action.0.sha256":                 base64.StdEncoding.EncodeToString(sum[:]),
+		"flatcar_action.0.is_delta":               "true",
+		"flatcar_action.0.metadata_size":          strconv.Itoa(20 + len(deltaManifest)),
+		"flatcar_action.0.metadata_signature_rsa": "",
+	}
+	for key, value := range want {
+		if attr := diff.Attributes[key]; attr == nil || attr.New != value {
+			t.Errorf("got %s diff %#v, want %q", key, attr, value)
+		}
+	}
+	if attr := diff.Attributes["hash"]; attr == nil || attr.New == "" {
+		t.Errorf("hash wasn't computed: %#v", attr)
+	}
+
+	delete(attrs, "source_file")
+	delete(raw, "source_file")
+	state = &terraform.InstanceState{RawConfig: rawConfig(r, raw)}
+	_, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(attrs), &apiClient{})
+	if err == nil || !strings.Contains(err.Error(), "required unless source_file is set") {
+		t.Errorf("got error %v for a package without size and source_file", err)
+	}
+}
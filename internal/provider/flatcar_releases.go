@@ -0,0 +1,338 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// defaultPayloadURLTemplate is the URL of the update payloads of the
+// official Flatcar releases.
+const defaultPayloadURLTemplate = "https://update.release.flatcar-linux.net/{arch}-usr/{version}/flatcar_production_update.gz"
+
+// flatcarFeedTimeout bounds fetching a release feed over HTTP.
+const flatcarFeedTimeout = time.Minute
+
+// maxFlatcarFeedSize bounds the size of a release feed.
+const maxFlatcarFeedSize = 32 << 20
+
+// flatcarArches maps the architectures of the Flatcar releases to Nebraska's.
+var flatcarArches = map[string]string{
+	"amd64": "amd64",
+	"arm64": "aarch64",
+}
+
+// flatcarFeedRelease is a release of the Flatcar release metadata JSON, e.g.
+// https://www.flatcar.org/releases-json/releases.json, keyed by version.
+// Payloads isn't part of Flatcar's feed, mirrors can add it to publish the
+// payloads of each architecture.
+type flatcarFeedRelease struct {
+	Channel       string                        `json:"channel"`
+	ReleaseDate   string                        `json:"release_date"`
+	Architectures []string                      `json:"architectures"`
+	Payloads      map[string]flatcarFeedPayload `json:"payloads"`
+}
+
+type flatcarFeedPayload struct {
+	URL    string      `json:"url"`
+	Size   json.Number `json:"size"`
+	SHA1   string      `json:"sha1"`
+	SHA256 string      `json:"sha256"`
+}
+
+// flatcarRelease is the update payload of a release for one architecture.
+type flatcarRelease struct {
+	Version     string
+	Channel     string
+	ReleaseDate string
+	// Arch is the Nebraska architecture.
+	Arch string
+	// URL is the URL of the directory of the payload, Filename its name.
+	URL      string
+	Filename string
+	// Size, Hash and SHA256 are empty when the feed doesn't publish them,
+	// the hashes are base64 encoded.
+	Size   string
+	Hash   string
+	SHA256 string
+}
+
+// key identifies the release in a Nebraska application, <version>/<arch>.
+func (r flatcarRelease) key() string {
+	return r.Version + "/" + r.Arch
+}
+
+// flatcarFeedOptions selects the releases of a feed.
+type flatcarFeedOptions struct {
+	URL  string
+	File string
+	// PayloadURLTemplate is the URL of the payloads the feed doesn't
+	// publish, {version} and {arch} are replaced by the Flatcar version and
+	// architecture.
+	PayloadURLTemplate string
+	Channels           []string
+	// Arches are Nebraska architectures.
+	Arches     []string
+	MinVersion string
+	// Latest keeps only the latest versions of each channel, 0 keeps all.
+	Latest int
+}
+
+// flatcarFeedSchema returns the arguments selecting the releases of a feed,
+// shared by the nebraska_flatcar_releases data source and the
+// nebraska_flatcar_release_sync resource.
+func flatcarFeedSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"url": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ExactlyOneOf: []string{"url", "file"},
+			ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+			Description:  "URL of the Flatcar release metadata JSON, e.g. `https://www.flatcar.org/releases-json/releases.json`.",
+		},
+		"file": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ExactlyOneOf: []string{"url", "file"},
+			ValidateFunc: validation.StringIsNotEmpty,
+			Description:  "Path of a local copy of the Flatcar release metadata JSON.",
+		},
+		"payload_url_template": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			Default:      defaultPayloadURLTemplate,
+			ValidateFunc: validation.StringIsNotEmpty,
+			Description:  "URL of the update payloads the feed doesn't list in the `payloads` of a release, `{version}` and `{arch}` are replaced by the Flatcar version and architecture.",
+		},
+		"channels": {
+			Type:        schema.TypeSet,
+			Optional:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "Only select the releases of these channels, e.g. `stable`.",
+		},
+		"arches": {
+			Type:     schema.TypeSet,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type:         schema.TypeString,
+				ValidateFunc: validation.StringInSlice([]string{"amd64", "aarch64"}, false),
+			},
+			Description: "Only select the payloads of these Nebraska architectures, `amd64` or `aarch64`.",
+		},
+		"min_version": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validation.StringMatch(flatcarVersionRegexp, "must be a version such as 3510.2.1"),
+			Description:  "Only select the releases of this version or later.",
+		},
+		"latest": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntAtLeast(0),
+			Description:  "Only select this many of the latest versions of each channel, `0` selects all of them.",
+		},
+	}
+}
+
+// flatcarFeedOptionsFrom returns the options of the flatcarFeedSchema
+// arguments read with get, e.g. ResourceData.Get.
+func flatcarFeedOptionsFrom(get func(string) interface{}) flatcarFeedOptions {
+	return flatcarFeedOptions{
+		URL:                get("url").(string),
+		File:               get("file").(string),
+		PayloadURLTemplate: get("payload_url_template").(string),
+		Channels:           arrInterfaceToarrString(get("channels").(*schema.Set).List()),
+		Arches:             arrInterfaceToarrString(get("arches").(*schema.Set).List()),
+		MinVersion:         get("min_version").(string),
+		Latest:             get("latest").(int),
+	}
+}
+
+// flatcarReleases fetches the feed of opts and returns its selected releases,
+// sorted by version and architecture.
+func flatcarReleases(ctx context.Context, opts flatcarFeedOptions) ([]flatcarRelease, error) {
+	feed, err := fetchFlatcarFeed(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := parseFlatcarFeed(feed, opts.PayloadURLTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return filterFlatcarReleases(releases, opts), nil
+}
+
+// fetchFlatcarFeed reads the feed from opts.File or downloads it from
+// opts.URL.
+func fetchFlatcarFeed(ctx context.Context, opts flatcarFeedOptions) ([]byte, error) {
+	if opts.File != "" {
+		return ioutil.ReadFile(opts.File)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, flatcarFeedTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, opts.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: got response code %d", opts.URL, resp.StatusCode)
+	}
+	feed, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFlatcarFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %v", opts.URL, err)
+	}
+	if len(feed) > maxFlatcarFeedSize {
+		return nil, fmt.Errorf("GET %s: the feed is larger than %d bytes", opts.URL, maxFlatcarFeedSize)
+	}
+	return feed, nil
+}
+
+// parseFlatcarFeed returns a release per version and architecture of the
+// release metadata JSON feed. Entries whose key isn't a version, such as
+// "current", are skipped.
+func parseFlatcarFeed(feed []byte, payloadURLTemplate string) ([]flatcarRelease, error) {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(feed, &entries); err != nil {
+		return nil, fmt.Errorf("invalid release feed: %v", err)
+	}
+
+	var releases []flatcarRelease
+	for version, entry := range entries {
+		if !isFlatcarVersion(version) {
+			continue
+		}
+		var r flatcarFeedRelease
+		if err := json.Unmarshal(entry, &r); err != nil {
+			return nil, fmt.Errorf("invalid release %s: %v", version, err)
+		}
+		for _, flatcarArch := range r.Architectures {
+			arch, ok := flatcarArches[flatcarArch]
+			if !ok {
+				continue
+			}
+			payload := r.Payloads[flatcarArch]
+			payloadURL := payload.URL
+			if payloadURL == "" {
+				payloadURL = strings.NewReplacer("{version}", version, "{arch}", flatcarArch).Replace(payloadURLTemplate)
+			}
+			dir, filename := path.Split(payloadURL)
+			releases = append(releases, flatcarRelease{
+				Version:     version,
+				Channel:     r.Channel,
+				ReleaseDate: r.ReleaseDate,
+				Arch:        arch,
+				URL:         dir,
+				Filename:    filename,
+				Size:        payload.Size.String(),
+				Hash:        payload.SHA1,
+				SHA256:      payload.SHA256,
+			})
+		}
+	}
+	sortFlatcarReleases(releases)
+	return releases, nil
+}
+
+// filterFlatcarReleases returns the releases selected by opts, releases must
+// be sorted.
+func filterFlatcarReleases(releases []flatcarRelease, opts flatcarFeedOptions) []flatcarRelease {
+	contains := func(list []string, s string) bool {
+		if len(list) == 0 {
+			return true
+		}
+		for _, item := range list {
+			if item == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the latest versions of each channel, the releases are sorted.
+	latest := map[string]map[string]bool{}
+	if opts.Latest > 0 {
+		for i := len(releases) - 1; i >= 0; i-- {
+			r := releases[i]
+			versions := latest[r.Channel]
+			if versions == nil {
+				versions = map[string]bool{}
+				latest[r.Channel] = versions
+			}
+			if len(versions) < opts.Latest {
+				versions[r.Version] = true
+			}
+		}
+	}
+
+	filtered := []flatcarRelease{}
+	for _, r := range releases {
+		if !contains(opts.Channels, r.Channel) || !contains(opts.Arches, r.Arch) {
+			continue
+		}
+		if opts.MinVersion != "" && compareFlatcarVersions(r.Version, opts.MinVersion) < 0 {
+			continue
+		}
+		if opts.Latest > 0 && !latest[r.Channel][r.Version] {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
+
+func sortFlatcarReleases(releases []flatcarRelease) {
+	sort.Slice(releases, func(i, j int) bool {
+		if c := compareFlatcarVersions(releases[i].Version, releases[j].Version); c != 0 {
+			return c < 0
+		}
+		return releases[i].Arch < releases[j].Arch
+	})
+}
+
+// flatcarVersionRegexp matches versions such as 3510.2.1.
+var flatcarVersionRegexp = regexp.MustCompile(`^\d+(?:\.\d+)*$`)
+
+// isFlatcarVersion reports whether s is a version such as 3510.2.1.
+func isFlatcarVersion(s string) bool {
+	return flatcarVersionRegexp.MatchString(s)
+}
+
+// compareFlatcarVersions compares the versions a and b part by part, it
+// returns -1, 0 or 1.
+func compareFlatcarVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var ai, bi int
+		if i < len(as) {
+			ai, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bi, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case ai < bi:
+			return -1
+		case ai > bi:
+			return 1
+		}
+	}
+	return 0
+}
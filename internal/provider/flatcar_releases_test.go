@@ -0,0 +1,252 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// testFlatcarFeed is a release feed in the format of Flatcar's, the stable
+// releases list their payloads like a mirror would.
+const testFlatcarFeed = `{
+  "current": {"channel": "stable", "architectures": ["amd64"]},
+  "3510.2.1": {
+    "channel": "stable",
+    "release_date": "2023-04-26 12:00:00 +0000",
+    "architectures": ["amd64", "arm64"],
+    "payloads": {
+      "amd64": {"url": "https://mirror.example.com/amd64/3510.2.1/flatcar_production_update.gz", "size": 465881871, "sha1": "c2hhMQ==", "sha256": "c2hhMjU2"},
+      "arm64": {"url": "https://mirror.example.com/arm64/3510.2.1/flatcar_production_update.gz", "size": "401234567", "sha1": "c2hhMQ==", "sha256": "c2hhMjU2"}
+    }
+  },
+  "3374.2.5": {
+    "channel": "stable",
+    "release_date": "2023-03-01 12:00:00 +0000",
+    "architectures": ["amd64"],
+    "payloads": {
+      "amd64": {"url": "https://mirror.example.com/amd64/3374.2.5/flatcar_production_update.gz", "size": 455881871, "sha1": "b2xkMQ==", "sha256": "b2xkMjU2"}
+    }
+  },
+  "3602.1.0": {
+    "channel": "beta",
+    "release_date": "2023-05-02 12:00:00 +0000",
+    "architectures": ["amd64", "riscv"]
+  }
+}`
+
+func TestParseFlatcarFeed(t *testing.T) {
+	releases, err := parseFlatcarFeed([]byte(testFlatcarFeed), defaultPayloadURLTemplate)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	var keys []string
+	for _, r := range releases {
+		keys = append(keys, r.key())
+	}
+	if want := "3374.2.5/amd64 3510.2.1/aarch64 3510.2.1/amd64 3602.1.0/amd64"; strings.Join(keys, " ") != want {
+		t.Errorf("got releases %v, want %s", keys, want)
+	}
+
+	arm := releases[1]
+	if arm.URL != "https://mirror.example.com/arm64/3510.2.1/" || arm.Filename != "flatcar_production_update.gz" || arm.Size != "401234567" || arm.Hash != "c2hhMQ==" {
+		t.Errorf("unexpected release %+v", arm)
+	}
+	beta := releases[3]
+	if beta.URL != "https://update.release.flatcar-linux.net/amd64-usr/3602.1.0/" || beta.Size != "" || beta.Channel != "beta" {
+		t.Errorf("unexpected release %+v", beta)
+	}
+
+	if _, err := parseFlatcarFeed([]byte(`{"3510.2.1": {"architectures": "amd64"}}`), defaultPayloadURLTemplate); err == nil {
+		t.Errorf("parsing an invalid release succeeded")
+	}
+}
+
+func TestFilterFlatcarReleases(t *testing.T) {
+	releases, err := parseFlatcarFeed([]byte(testFlatcarFeed), defaultPayloadURLTemplate)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	cases := []struct {
+		name string
+		opts flatcarFeedOptions
+		want string
+	}{
+		{"all", flatcarFeedOptions{}, "3374.2.5/amd64 3510.2.1/aarch64 3510.2.1/amd64 3602.1.0/amd64"},
+		{"channel", flatcarFeedOptions{Channels: []string{"stable"}}, "3374.2.5/amd64 3510.2.1/aarch64 3510.2.1/amd64"},
+		{"arch", flatcarFeedOptions{Arches: []string{"aarch64"}}, "3510.2.1/aarch64"},
+		{"min version", flatcarFeedOptions{MinVersion: "3510.2"}, "3510.2.1/aarch64 3510.2.1/amd64 3602.1.0/amd64"},
+		{"latest", flatcarFeedOptions{Latest: 1}, "3510.2.1/aarch64 3510.2.1/amd64 3602.1.0/amd64"},
+		{"latest stable amd64", flatcarFeedOptions{Channels: []string{"stable"}, Arches: []string{"amd64"}, Latest: 2}, "3374.2.5/amd64 3510.2.1/amd64"},
+		{"none", flatcarFeedOptions{Channels: []string{"lts"}}, ""},
+	}
+	for _, tc := range cases {
+		var keys []string
+		for _, r := range filterFlatcarReleases(releases, tc.opts) {
+			keys = append(keys, r.key())
+		}
+		if got := strings.Join(keys, " "); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCompareFlatcarVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"3510.2.1", "3510.2.1", 0},
+		{"3510.2.1", "3510.10.0", -1},
+		{"3602.0.0", "3510.2.1", 1},
+		{"3510.2", "3510.2.0", 0},
+	}
+	for _, tc := range cases {
+		if got := compareFlatcarVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("%s, %s: got %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDataSourceFlatcarReleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, testFlatcarFeed)
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceFlatcarReleases().Schema, map[string]interface{}{
+		"url":    server.URL + "/releases.json",
+		"arches": []interface{}{"amd64"},
+	})
+	if diags := dataSourceFlatcarReleasesRead(context.Background(), d, nil); diags.HasError() {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	if n := d.Get("releases.#").(int); n != 3 {
+		t.Errorf("got %d releases, want 3", n)
+	}
+	if got := d.Get("releases.1.size").(string); got != "465881871" {
+		t.Errorf("got size %q", got)
+	}
+	latest := d.Get("latest_versions").(map[string]interface{})
+	if latest["stable"] != "3510.2.1" || latest["beta"] != "3602.1.0" {
+		t.Errorf("unexpected latest versions %v", latest)
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceFlatcarReleases().Schema, map[string]interface{}{
+		"url": server.URL + "/missing.json",
+	})
+	if diags := dataSourceFlatcarReleasesRead(context.Background(), d, nil); !diags.HasError() || !strings.Contains(diags[0].Detail, "404") {
+		t.Errorf("unexpected diagnostics: %#v", diags)
+	}
+}
+
+func TestFlatcarReleaseSync(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	// an existing package of a selected release is adopted.
+	fake.packages[testAppID] = []codegen.Package{{Id: "pkg-old", Version: "3510.2.1", Arch: 1}}
+	c := newFakeClient(t, server, nil)
+
+	feed := filepath.Join(t.TempDir(), "releases.json")
+	if err := os.WriteFile(feed, []byte(testFlatcarFeed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := resourceFlatcarReleaseSync()
+	apply := func(t *testing.T, state *terraform.InstanceState, latest int, prune bool) (*terraform.InstanceState, diag.Diagnostics) {
+		config := map[string]interface{}{
+			"application_id": testAppID,
+			"file":           feed,
+			"channels":       []interface{}{"stable"},
+			"latest":         latest,
+			"prune":          prune,
+		}
+		raw := map[string]cty.Value{
+			"application_id": cty.StringVal(testAppID),
+			"file":           cty.StringVal(feed),
+			"channels":       cty.SetVal([]cty.Value{cty.StringVal("stable")}),
+			"latest":         cty.NumberIntVal(int64(latest)),
+			"prune":          cty.BoolVal(prune),
+		}
+		if state == nil {
+			state = &terraform.InstanceState{}
+		}
+		state.RawConfig = rawConfig(r, raw)
+		diff, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(config), c)
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		return r.Apply(context.Background(), state, diff, c)
+	}
+
+	state, diags := apply(t, nil, 0, false)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if !strings.HasPrefix(state.ID, testAppID+"/") {
+		t.Errorf("got ID %q, want it to start with the application", state.ID)
+	}
+	// a sync of another channel of the same feed gets another ID.
+	beta := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{"file": feed, "channels": []interface{}{"beta"}})
+	if state.ID == testAppID+"/"+flatcarReleaseSyncHash(beta) {
+		t.Errorf("syncs of stable and beta share ID %q", state.ID)
+	}
+	if got := state.Attributes["packages.3510.2.1/amd64"]; got != "pkg-old" {
+		t.Errorf("existing package wasn't adopted: %q", got)
+	}
+	if got := state.Attributes["adopted_package_ids.#"]; got != "1" {
+		t.Errorf("got %s adopted packages, want 1", got)
+	}
+	if len(fake.packages[testAppID]) != 3 {
+		t.Fatalf("got packages %#v, want 3", fake.packages[testAppID])
+	}
+	created := state.Attributes["packages.3374.2.5/amd64"]
+	var pkg codegen.Package
+	for _, p := range fake.packages[testAppID] {
+		if p.Id == created {
+			pkg = p
+		}
+	}
+	if pkg.Version != "3374.2.5" || pkg.Url != "https://mirror.example.com/amd64/3374.2.5/" || pkg.FlatcarAction == nil {
+		t.Errorf("unexpected package %#v", pkg)
+	}
+
+	// the package of a release no longer selected is pruned, unless a
+	// channel points to it.
+	fake.channels[testAppID] = []codegen.Channel{{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: created}}
+	if _, diags := apply(t, state, 1, true); !diags.HasError() || diags[0].Summary != "Package is in use" {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	// the channel is moved to another package outside of Terraform.
+	fake.channels[testAppID] = nil
+	c.lists.invalidate(listKindChannels, testAppID)
+	state, diags = apply(t, state, 1, true)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if _, ok := state.Attributes["packages.3374.2.5/amd64"]; ok || len(fake.packages[testAppID]) != 2 {
+		t.Errorf("package wasn't pruned: %v %#v", state.Attributes, fake.packages[testAppID])
+	}
+
+	// destroying with prune deletes the created packages, not the adopted
+	// ones.
+	if _, diags := r.Apply(context.Background(), state, &terraform.InstanceDiff{Destroy: true}, c); diags.HasError() {
+		t.Fatalf("destroy failed: %#v", diags)
+	}
+	if len(fake.packages[testAppID]) != 1 || fake.packages[testAppID][0].Id != "pkg-old" {
+		t.Errorf("got packages %#v, want only the adopted one", fake.packages[testAppID])
+	}
+}
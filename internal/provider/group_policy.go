@@ -0,0 +1,254 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// groupPolicyFallbacks are the values of the policy attributes a group and
+// the provider group_policy_defaults both omit.
+var groupPolicyFallbacks = map[string]interface{}{
+	"policy_updates_enabled":        false,
+	"policy_safe_mode":              false,
+	"policy_office_hours":           false,
+	"policy_timezone":               "Asia/Calcutta",
+	"policy_period_interval":        "1 hours",
+	"policy_max_updates_per_period": 1,
+	"policy_update_timeout":         "1 days",
+}
+
+// builtinGroupPolicyPresets are the policy_preset values available without
+// declaring them on the provider.
+var builtinGroupPolicyPresets = map[string]map[string]interface{}{
+	// canary updates one instance an hour, stopping on the first failure.
+	"canary": {
+		"policy_safe_mode":              true,
+		"policy_max_updates_per_period": 1,
+		"policy_period_interval":        "1 hours",
+	},
+	// bulk updates 50 instances every 10 minutes during office hours.
+	"bulk": {
+		"policy_max_updates_per_period": 50,
+		"policy_period_interval":        "10 minutes",
+		"policy_office_hours":           true,
+	},
+	// paused doesn't update any instance.
+	"paused": {
+		"policy_updates_enabled": false,
+	},
+}
+
+// groupPolicySchema returns the schema of the policy attributes of the
+// provider group_policy_defaults and group_policy_preset blocks.
+func groupPolicySchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"policy_updates_enabled": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Description: "Enable updates.",
+		},
+		"policy_safe_mode": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Description: "Safe mode will only update 1 instance at a time, and stop if an update fails.",
+		},
+		"policy_office_hours": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Description: "Only update between 9am and 5pm.",
+		},
+		"policy_timezone": {
+			Type:        schema.TypeString,
+			Optional:    true,
+			Description: "Timezone used to inform `policy_office_hours`.",
+		},
+		"policy_period_interval": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateInterval,
+			Description:  "Period used in combination with `policy_max_updates_per_period`.",
+		},
+		"policy_max_updates_per_period": {
+			Type:        schema.TypeInt,
+			Optional:    true,
+			Description: "The maximum number of updates that can be performed within the `policy_period_interval`.",
+		},
+		"policy_update_timeout": {
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateInterval,
+			Description:  "Timeout for updates.",
+		},
+	}
+}
+
+// groupPolicyPresetSchema returns the schema of the provider
+// group_policy_preset blocks.
+func groupPolicyPresetSchema() map[string]*schema.Schema {
+	s := groupPolicySchema()
+	s["name"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Required:     true,
+		ValidateFunc: validation.StringIsNotEmpty,
+		Description:  "Name of the preset.",
+	}
+	return s
+}
+
+// groupPolicyValues returns the policy attributes set in the provider block
+// at prefix, e.g. group_policy_defaults.0. The provider gets no raw
+// configuration, GetOkExists tells the attributes set to false or zero from
+// the omitted ones.
+func groupPolicyValues(d *schema.ResourceData, prefix string) map[string]interface{} {
+	values := map[string]interface{}{}
+	for key := range groupPolicyFallbacks {
+		if v, ok := d.GetOkExists(prefix + key); ok {
+			values[key] = v
+		}
+	}
+	return values
+}
+
+// groupPolicyDefaults returns the defaults of the group policy attributes:
+// the values set in the provider group_policy_defaults block, falling back to
+// groupPolicyFallbacks.
+func groupPolicyDefaults(d *schema.ResourceData) map[string]interface{} {
+	defaults := make(map[string]interface{}, len(groupPolicyFallbacks))
+	for key, value := range groupPolicyFallbacks {
+		defaults[key] = value
+	}
+	if blocks := d.Get("group_policy_defaults").([]interface{}); len(blocks) > 0 && blocks[0] != nil {
+		for key, value := range groupPolicyValues(d, "group_policy_defaults.0.") {
+			defaults[key] = value
+		}
+	}
+	return defaults
+}
+
+// groupPolicyPresets returns the presets available to policy_preset, the
+// built-in ones and those of the provider group_policy_preset blocks, which
+// replace built-in presets of the same name.
+func groupPolicyPresets(d *schema.ResourceData) map[string]map[string]interface{} {
+	presets := make(map[string]map[string]interface{}, len(builtinGroupPolicyPresets))
+	for name, preset := range builtinGroupPolicyPresets {
+		presets[name] = preset
+	}
+	for i, block := range d.Get("group_policy_preset").([]interface{}) {
+		if block == nil {
+			continue
+		}
+		m := block.(map[string]interface{})
+		presets[m["name"].(string)] = groupPolicyValues(d, fmt.Sprintf("group_policy_preset.%d.", i))
+	}
+	return presets
+}
+
+// equivalentPolicyValues reports whether a and b are the same value of the
+// policy attribute key, intervals are compared by their duration.
+func equivalentPolicyValues(key string, a, b interface{}) bool {
+	if key == "policy_period_interval" || key == "policy_update_timeout" {
+		return equivalentIntervals(a.(string), b.(string))
+	}
+	return a == b
+}
+
+// omittedGroupPolicy returns the values of the policy attributes config
+// omits, taking them from the preset named preset, then the provider
+// group_policy_defaults, then groupPolicyFallbacks.
+func omittedGroupPolicy(c *apiClient, config cty.Value, preset string) (map[string]interface{}, error) {
+	var presetValues map[string]interface{}
+	if preset != "" {
+		var ok bool
+		if presetValues, ok = c.groupPolicyPresets[preset]; !ok {
+			names := make([]string, 0, len(c.groupPolicyPresets))
+			for name := range c.groupPolicyPresets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown policy_preset %q, expected one of %s", preset, strings.Join(names, ", "))
+		}
+	}
+
+	values := map[string]interface{}{}
+	for key, fallback := range groupPolicyFallbacks {
+		if v := config.GetAttr(key); !v.IsNull() {
+			continue
+		}
+		value := fallback
+		if v, ok := c.groupPolicyDefaults[key]; ok {
+			value = v
+		}
+		if v, ok := presetValues[key]; ok {
+			value = v
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// customizeDiffGroupPolicyDefaults plans the policy attributes the group
+// configuration omits, see omittedGroupPolicy. They are left unknown when the
+// policy_preset is, fillGroupPolicy sets them at apply time.
+func customizeDiffGroupPolicyDefaults(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+	config := d.GetRawConfig()
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+
+	if !d.NewValueKnown("policy_preset") {
+		for key := range groupPolicyFallbacks {
+			if config.GetAttr(key).IsNull() {
+				if err := d.SetNewComputed(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	values, err := omittedGroupPolicy(c, config, d.Get("policy_preset").(string))
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		if d.NewValueKnown(key) && equivalentPolicyValues(key, d.Get(key), value) {
+			continue
+		}
+		if err := d.SetNew(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillGroupPolicy sets the policy attributes the group configuration omits
+// before creating or updating the group, the plan leaves them unknown when
+// it can't tell the policy_preset.
+func fillGroupPolicy(c *apiClient, d *schema.ResourceData) diag.Diagnostics {
+	config := d.GetRawConfig()
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+	values, err := omittedGroupPolicy(c, config, d.Get("policy_preset").(string))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid policy_preset",
+			Detail:        err.Error(),
+			AttributePath: cty.GetAttrPath("policy_preset"),
+		}}
+	}
+	for key, value := range values {
+		if !equivalentPolicyValues(key, d.Get(key), value) {
+			d.Set(key, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// rawConfig returns the raw configuration of resource r setting attrs, the
+// other attributes are null.
+func rawConfig(r *schema.Resource, attrs map[string]cty.Value) cty.Value {
+	values := map[string]cty.Value{}
+	for name, ty := range r.CoreConfigSchema().ImpliedType().AttributeTypes() {
+		values[name] = cty.NullVal(ty)
+		if v, ok := attrs[name]; ok {
+			values[name] = v
+		}
+	}
+	return cty.ObjectVal(values)
+}
+
+func TestGroupPolicyDefaults(t *testing.T) {
+	p := New("test")()
+	d := schema.TestResourceDataRaw(t, p.Schema, map[string]interface{}{
+		"group_policy_defaults": []interface{}{map[string]interface{}{
+			"policy_timezone":     "Europe/Berlin",
+			"policy_office_hours": true,
+		}},
+	})
+	c := &apiClient{groupPolicyDefaults: groupPolicyDefaults(d)}
+
+	r := resourceGroup()
+	state := &terraform.InstanceState{
+		ID: "grp-1",
+		Attributes: map[string]string{
+			"id":                            "grp-1",
+			"name":                          "prod-eu",
+			"application_id":                testAppID,
+			"policy_updates_enabled":        "false",
+			"policy_safe_mode":              "false",
+			"policy_office_hours":           "false",
+			"policy_timezone":               "Asia/Calcutta",
+			"policy_period_interval":        "1 hours",
+			"policy_max_updates_per_period": "1",
+			"policy_update_timeout":         "1 days",
+		},
+		RawConfig: rawConfig(r, map[string]cty.Value{
+			"name":                   cty.StringVal("prod-eu"),
+			"application_id":         cty.StringVal(testAppID),
+			"policy_period_interval": cty.StringVal("2 hours"),
+		}),
+	}
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":                   "prod-eu",
+		"application_id":         testAppID,
+		"policy_period_interval": "2 hours",
+	})
+	diff, err := r.Diff(context.Background(), state, config, c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+
+	want := map[string]string{
+		"policy_timezone":        "Europe/Berlin",
+		"policy_office_hours":    "true",
+		"policy_period_interval": "2 hours",
+	}
+	for key, value := range want {
+		if attr := diff.Attributes[key]; attr == nil || attr.New != value {
+			t.Errorf("got %s diff %#v, want %q", key, attr, value)
+		}
+	}
+	for _, key := range []string{"policy_updates_enabled", "policy_update_timeout", "policy_max_updates_per_period"} {
+		if attr := diff.Attributes[key]; attr != nil && attr.Old != attr.New {
+			t.Errorf("unexpected %s diff %#v", key, attr)
+		}
+	}
+}
+
+func TestGroupPolicyPreset(t *testing.T) {
+	p := New("test")()
+	d := schema.TestResourceDataRaw(t, p.Schema, map[string]interface{}{
+		"group_policy_defaults": []interface{}{map[string]interface{}{
+			"policy_timezone":     "Europe/Berlin",
+			"policy_office_hours": true,
+		}},
+		"group_policy_preset": []interface{}{
+			map[string]interface{}{
+				"name":                   "nightly",
+				"policy_updates_enabled": true,
+				"policy_update_timeout":  "2 days",
+			},
+			map[string]interface{}{
+				"name":                "anytime",
+				"policy_office_hours": false,
+			},
+		},
+	})
+	c := &apiClient{groupPolicyDefaults: groupPolicyDefaults(d), groupPolicyPresets: groupPolicyPresets(d)}
+
+	r := resourceGroup()
+	diff := func(preset string, attrs map[string]interface{}) (*terraform.InstanceDiff, error) {
+		config := map[string]interface{}{
+			"name":           "canary",
+			"application_id": testAppID,
+			"policy_preset":  preset,
+		}
+		raw := map[string]cty.Value{
+			"name":           cty.StringVal("canary"),
+			"application_id": cty.StringVal(testAppID),
+			"policy_preset":  cty.StringVal(preset),
+		}
+		for key, value := range attrs {
+			config[key] = value
+			raw[key] = cty.StringVal(value.(string))
+		}
+		state := &terraform.InstanceState{RawConfig: rawConfig(r, raw)}
+		// SimpleDiff is what Terraform plans with, Diff drops the raw
+		// configuration when recomputing the diff of a new group.
+		return r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(config), c)
+	}
+
+	tests := []struct {
+		preset string
+		attrs  map[string]interface{}
+		want   map[string]string
+	}{
+		{
+			preset: "canary",
+			attrs:  map[string]interface{}{"policy_period_interval": "2 hours"},
+			want: map[string]string{
+				"policy_safe_mode":              "true",
+				"policy_max_updates_per_period": "1",
+				"policy_period_interval":        "2 hours",
+				"policy_timezone":               "Europe/Berlin",
+				"policy_updates_enabled":        "false",
+			},
+		},
+		{
+			preset: "nightly",
+			want: map[string]string{
+				"policy_updates_enabled": "true",
+				"policy_update_timeout":  "2 days",
+				"policy_safe_mode":       "false",
+				"policy_timezone":        "Europe/Berlin",
+				"policy_office_hours":    "true",
+			},
+		},
+		{
+			preset: "anytime",
+			want: map[string]string{
+				"policy_office_hours": "false",
+				"policy_timezone":     "Europe/Berlin",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			diff, err := diff(tt.preset, tt.attrs)
+			if err != nil {
+				t.Fatalf("diff failed: %v", err)
+			}
+			for key, value := range tt.want {
+				if attr := diff.Attributes[key]; attr == nil || attr.New != value {
+					t.Errorf("got %s diff %#v, want %q", key, attr, value)
+				}
+			}
+		})
+	}
+
+	_, err := diff("unknown", nil)
+	if err == nil || !strings.Contains(err.Error(), "expected one of anytime, bulk, canary, nightly, paused") {
+		t.Errorf("got error %v for an unknown preset", err)
+	}
+}
+
+// unknownValue is how the SDK represents unknown values in a raw
+// configuration.
+const unknownValue = "74D93920-ED26-11E3-AC10-0800200C9A66"
+
+func TestGroupPolicyPresetUnknown(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.groups[testAppID] = []codegen.Group{{Id: "grp-1", Name: "canary", PolicyTimezone: "Asia/Calcutta", PolicyPeriodInterval: "1 hours", PolicyMaxUpdatesPerPeriod: 1, PolicyUpdateTimeout: "1 days"}}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceGroup()
+	state := &terraform.InstanceState{
+		ID: "grp-1",
+		Attributes: map[string]string{
+			"id":                            "grp-1",
+			"name":                          "canary",
+			"application_id":                testAppID,
+			"policy_updates_enabled":        "false",
+			"policy_safe_mode":              "false",
+			"policy_office_hours":           "false",
+			"policy_timezone":               "Asia/Calcutta",
+			"policy_period_interval":        "1 hours",
+			"policy_max_updates_per_period": "1",
+			"policy_update_timeout":         "1 days",
+		},
+		RawConfig: rawConfig(r, map[string]cty.Value{
+			"name":           cty.StringVal("canary"),
+			"application_id": cty.StringVal(testAppID),
+			"policy_preset":  cty.UnknownVal(cty.String),
+		}),
+	}
+	diff, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":           "canary",
+		"application_id": testAppID,
+		"policy_preset":  unknownValue,
+	}), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if attr := diff.Attributes["policy_safe_mode"]; attr == nil || !attr.NewComputed {
+		t.Fatalf("got policy_safe_mode diff %#v, want it unknown", attr)
+	}
+
+	// the preset is known when applying.
+	diff.Attributes["policy_preset"] = &terraform.ResourceAttrDiff{New: "canary"}
+	diff.RawConfig = rawConfig(r, map[string]cty.Value{
+		"name":           cty.StringVal("canary"),
+		"application_id": cty.StringVal(testAppID),
+		"policy_preset":  cty.StringVal("canary"),
+	})
+	state, diags := r.Apply(context.Background(), state, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %v", diags)
+	}
+	if group := fake.groups[testAppID][0]; !group.PolicySafeMode || group.PolicyTimezone != "Asia/Calcutta" {
+		t.Fatalf("got group %#v, want the canary preset", group)
+	}
+	if got := state.Attributes["policy_safe_mode"]; got != "true" {
+		t.Fatalf("got policy_safe_mode %q, want true", got)
+	}
+}
@@ -0,0 +1,202 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const day = 24 * time.Hour
+
+// intervalUnits are the units of Postgres intervals, months and years count
+// 30 and 360 days as in Postgres' interval arithmetic.
+var intervalUnits = map[string]time.Duration{
+	"microsecond": time.Microsecond,
+	"us":          time.Microsecond,
+	"millisecond": time.Millisecond,
+	"ms":          time.Millisecond,
+	"second":      time.Second,
+	"sec":         time.Second,
+	"s":           time.Second,
+	"minute":      time.Minute,
+	"min":         time.Minute,
+	"m":           time.Minute,
+	"hour":        time.Hour,
+	"hr":          time.Hour,
+	"h":           time.Hour,
+	"day":         day,
+	"d":           day,
+	"week":        7 * day,
+	"w":           7 * day,
+	"month":       30 * day,
+	"mon":         30 * day,
+	"year":        360 * day,
+	"yr":          360 * day,
+	"y":           360 * day,
+}
+
+var (
+	// intervalQuantity matches a quantity of the postgres and postgres_verbose
+	// interval styles, e.g. "2 hours" or "1 day".
+	intervalQuantity = regexp.MustCompile(`^([+-]?\d+(?:\.\d+)?)([a-z]+)$`)
+	// intervalSpace matches the space between a quantity and its unit.
+	intervalSpace = regexp.MustCompile(`(\d)\s+([a-z])`)
+	// intervalClock matches the time part of the postgres and sql_standard
+	// interval styles, e.g. "01:30:00" or "-00:10".
+	intervalClock = regexp.MustCompile(`^([+-])?(\d+):(\d{1,2})(?::(\d{1,2}(?:\.\d+)?))?$`)
+	// intervalISO matches the iso_8601 interval style, e.g. "PT1H30M".
+	intervalISO = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// parseInterval parses a Postgres interval in the textual forms Nebraska
+// accepts and returns, e.g. "1 hours", "60 minutes", "01:00:00", "1 day
+// 02:00:00", "@ 1 hour" or "PT1H".
+func parseInterval(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty interval")
+	}
+	if strings.HasPrefix(s, "p") {
+		return parseISOInterval(strings.ToUpper(s))
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(s, "@"))
+
+	// join the quantities to their units, "2 hours" becomes "2hours".
+	fields := strings.Fields(intervalSpace.ReplaceAllString(s, "$1$2"))
+
+	var total time.Duration
+	for _, f := range fields {
+		if m := intervalClock.FindStringSubmatch(f); m != nil {
+			hours, _ := strconv.Atoi(m[2])
+			minutes, _ := strconv.Atoi(m[3])
+			var seconds float64
+			if m[4] != "" {
+				seconds, _ = strconv.ParseFloat(m[4], 64)
+			}
+			if minutes > 59 || seconds >= 60 {
+				return 0, fmt.Errorf("invalid interval %q", s)
+			}
+			d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds*float64(time.Second))
+			if m[1] == "-" {
+				d = -d
+			}
+			total += d
+			continue
+		}
+		m := intervalQuantity.FindStringSubmatch(f)
+		if m == nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q: %v", s, err)
+		}
+		unit, ok := intervalUnits[m[2]]
+		if !ok {
+			unit, ok = intervalUnits[strings.TrimSuffix(m[2], "s")]
+		}
+		if !ok {
+			return 0, fmt.Errorf("invalid interval %q: unknown unit %q", s, m[2])
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return total, nil
+}
+
+// parseISOInterval parses the iso_8601 style of Postgres intervals.
+func parseISOInterval(s string) (time.Duration, error) {
+	m := intervalISO.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	units := []time.Duration{360 * day, 30 * day, 7 * day, day, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid interval %q: %v", s, err)
+		}
+		total += time.Duration(n * float64(unit))
+	}
+	return total, nil
+}
+
+// formatInterval formats d in the canonical form of the provider, the form of
+// the policy defaults, e.g. "1 hours" or "1 days 12 hours".
+func formatInterval(d time.Duration) string {
+	if d == 0 {
+		return "0 seconds"
+	}
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	var parts []string
+	for _, u := range []struct {
+		name string
+		unit time.Duration
+	}{
+		{"days", day},
+		{"hours", time.Hour},
+		{"minutes", time.Minute},
+		{"seconds", time.Second},
+	} {
+		if n := d / u.unit; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s%d %s", sign, n, u.name))
+			d -= n * u.unit
+		}
+	}
+	if d > 0 {
+		parts = append(parts, fmt.Sprintf("%s%d microseconds", sign, d/time.Microsecond))
+	}
+	return strings.Join(parts, " ")
+}
+
+// normalizeInterval returns the canonical form of the interval s, or s itself
+// when it can't be parsed.
+func normalizeInterval(s string) string {
+	d, err := parseInterval(s)
+	if err != nil {
+		return s
+	}
+	return formatInterval(d)
+}
+
+// equivalentIntervals reports whether a and b are the same interval, written
+// differently.
+func equivalentIntervals(a, b string) bool {
+	if a == b {
+		return true
+	}
+	da, err := parseInterval(a)
+	if err != nil {
+		return false
+	}
+	db, err := parseInterval(b)
+	return err == nil && da == db
+}
+
+// suppressEquivalentInterval suppresses the diffs between two forms of the
+// same interval, e.g. "60 minutes" and "1 hours".
+func suppressEquivalentInterval(k, old, new string, d *schema.ResourceData) bool {
+	return equivalentIntervals(old, new)
+}
+
+// validateInterval accepts the Postgres intervals parseInterval understands.
+func validateInterval(v interface{}, key string) ([]string, []error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, []error{fmt.Errorf("expected type of %s to be string", key)}
+	}
+	if _, err := parseInterval(s); err != nil {
+		return nil, []error{fmt.Errorf("%s: %v, expected e.g. \"1 hours\" or \"30 minutes\"", key, err)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Duration
+	}{
+		// forms written by users and the provider defaults
+		{"1 hours", time.Hour},
+		{"1 hour", time.Hour},
+		{"60 minutes", time.Hour},
+		{"10 mins", 10 * time.Minute},
+		{"1 days", 24 * time.Hour},
+		{"1.5 hours", 90 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"1 hours 30 minutes", 90 * time.Minute},
+		{"1 week", 7 * 24 * time.Hour},
+		// postgres style, the server default
+		{"01:00:00", time.Hour},
+		{"00:10:00", 10 * time.Minute},
+		{"1 day", 24 * time.Hour},
+		{"7 days", 7 * 24 * time.Hour},
+		{"1 day 02:00:00", 26 * time.Hour},
+		{"1 mon", 30 * 24 * time.Hour},
+		{"-01:00:00", -time.Hour},
+		{"00:00:30.5", 30*time.Second + 500*time.Millisecond},
+		// postgres_verbose style
+		{"@ 1 hour", time.Hour},
+		{"@ 1 day 2 hours", 26 * time.Hour},
+		{"@ 10 mins", 10 * time.Minute},
+		// sql_standard style
+		{"1:00:00", time.Hour},
+		// iso_8601 style
+		{"PT1H", time.Hour},
+		{"PT10M", 10 * time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"PT0.5S", 500 * time.Millisecond},
+	}
+	for _, tc := range cases {
+		got, err := parseInterval(tc.in)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "1 fortnight", "hour", "01:60:00", "P", "PT", "1 hour and a bit"} {
+		if d, err := parseInterval(in); err == nil {
+			t.Errorf("%q: got %s, want an error", in, d)
+		}
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	cases := []struct {
+		in   time.Duration
+		want string
+	}{
+		{0, "0 seconds"},
+		{time.Hour, "1 hours"},
+		{10 * time.Minute, "10 minutes"},
+		{24 * time.Hour, "1 days"},
+		{26*time.Hour + 30*time.Minute, "1 days 2 hours 30 minutes"},
+		{90 * time.Second, "1 minutes 30 seconds"},
+		{-time.Hour, "-1 hours"},
+		{1500 * time.Millisecond, "1 seconds 500000 microseconds"},
+	}
+	for _, tc := range cases {
+		got := formatInterval(tc.in)
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.in, got, tc.want)
+		}
+		if d, err := parseInterval(got); err != nil || d != tc.in {
+			t.Errorf("%q doesn't parse back to %s: %s, %v", got, tc.in, d, err)
+		}
+	}
+}
+
+func TestEquivalentIntervals(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"1 hours", "60 minutes", true},
+		{"1 hours", "01:00:00", true},
+		{"1 days", "1 day", true},
+		{"1 days", "24:00:00", true},
+		{"1 days", "PT24H", true},
+		{"1 hours", "2 hours", false},
+		{"1 hours", "1 days", false},
+		{"bogus", "bogus", true},
+		{"bogus", "1 hours", false},
+	}
+	for _, tc := range cases {
+		if got := suppressEquivalentInterval("policy_period_interval", tc.a, tc.b, nil); got != tc.want {
+			t.Errorf("%q, %q: got %t, want %t", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	if got := normalizeInterval("01:00:00"); got != "1 hours" {
+		t.Errorf("got %q, want %q", got, "1 hours")
+	}
+	if got := normalizeInterval("bogus"); got != "bogus" {
+		t.Errorf("got %q, want the unparsable interval unchanged", got)
+	}
+}
@@ -0,0 +1,279 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+const (
+	// paginationPerPage is the page size requested from the paginated endpoints.
+	paginationPerPage = 100
+	// paginationParallelism bounds the number of pages fetched concurrently.
+	paginationParallelism = 4
+)
+
+// pageFetcher fetches a single page and returns the total count of items
+// reported by the server.
+type pageFetcher func(ctx context.Context, page, perPage int) (totalCount int, err error)
+
+// pageCount returns the number of pages needed to hold totalCount items.
+func pageCount(totalCount, perPage int) int {
+	if totalCount <= 0 {
+		return 1
+	}
+	return (totalCount + perPage - 1) / perPage
+}
+
+// fetchAllPages fetches the first page to learn the total count and then the
+// remaining pages concurrently, with at most parallelism requests in flight.
+// The first error cancels the pages still to be fetched.
+func fetchAllPages(ctx context.Context, perPage, parallelism int, fetch pageFetcher) error {
+	totalCount, err := fetch(ctx, 1, perPage)
+	if err != nil {
+		return err
+	}
+	totalPages := pageCount(totalCount, perPage)
+	if totalPages == 1 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		sem      = make(chan struct{}, parallelism)
+	)
+	for page := 2; page <= totalPages; page++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if _, err := fetch(ctx, page, perPage); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// pageSlots collects the items of each page in page order.
+type pageSlots struct {
+	mu    sync.Mutex
+	pages map[int]interface{}
+}
+
+func (s *pageSlots) set(page int, items interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pages == nil {
+		s.pages = map[int]interface{}{}
+	}
+	s.pages[page] = items
+}
+
+func (s *pageSlots) ordered() []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ordered := make([]interface{}, 0, len(s.pages))
+	for page := 1; len(ordered) < len(s.pages); page++ {
+		if items, ok := s.pages[page]; ok {
+			ordered = append(ordered, items)
+		}
+	}
+	return ordered
+}
+
+// listCache caches the full listings of an application's channels, groups and
+// packages for the lifetime of the provider, so that data sources reading the
+// same application share a single set of requests.
+type listCache struct {
+	mu      sync.Mutex
+	entries map[string]*listCacheEntry
+}
+
+type listCacheEntry struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+func listCacheKey(kind, appID string) string {
+	return kind + "/" + appID
+}
+
+// get returns the cached listing for kind and appID, loading it once.
+// Failed loads aren't cached.
+func (lc *listCache) get(kind, appID string, load func() (interface{}, error)) (interface{}, error) {
+	key := listCacheKey(kind, appID)
+
+	lc.mu.Lock()
+	if lc.entries == nil {
+		lc.entries = map[string]*listCacheEntry{}
+	}
+	entry, ok := lc.entries[key]
+	if !ok {
+		entry = &listCacheEntry{}
+		lc.entries[key] = entry
+	}
+	lc.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.value, entry.err = load()
+	})
+	if entry.err != nil {
+		lc.mu.Lock()
+		if lc.entries[key] == entry {
+			delete(lc.entries, key)
+		}
+		lc.mu.Unlock()
+	}
+	return entry.value, entry.err
+}
+
+// invalidate drops the cached listing for kind and appID, it must be called
+// whenever an object of that kind is created, updated or deleted.
+func (lc *listCache) invalidate(kind, appID string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	delete(lc.entries, listCacheKey(kind, appID))
+}
+
+const (
+	listKindChannels = "channels"
+	listKindGroups   = "groups"
+	listKindPackages = "packages"
+)
+
+// listChannels returns all the channels of the application.
+func (c *apiClient) listChannels(ctx context.Context, appID string) ([]codegen.Channel, error) {
+	value, err := c.lists.get(listKindChannels, appID, func() (interface{}, error) {
+		var slots pageSlots
+		err := fetchAllPages(ctx, paginationPerPage, paginationParallelism, func(ctx context.Context, page, perPage int) (int, error) {
+			resp, err := c.client.PaginateChannelsWithResponse(ctx, appID, &codegen.PaginateChannelsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+			if err != nil {
+				return 0, err
+			}
+			if resp.JSON200 == nil {
+				return 0, newAPIError(resp.HTTPResponse, resp.Body)
+			}
+			slots.set(page, resp.JSON200.Channels)
+			return resp.JSON200.TotalCount, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		channels := []codegen.Channel{}
+		for _, items := range slots.ordered() {
+			channels = append(channels, items.([]codegen.Channel)...)
+		}
+		return channels, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]codegen.Channel), nil
+}
+
+// listGroups returns all the groups of the application.
+func (c *apiClient) listGroups(ctx context.Context, appID string) ([]codegen.Group, error) {
+	value, err := c.lists.get(listKindGroups, appID, func() (interface{}, error) {
+		var slots pageSlots
+		err := fetchAllPages(ctx, paginationPerPage, paginationParallelism, func(ctx context.Context, page, perPage int) (int, error) {
+			resp, err := c.client.PaginateGroupsWithResponse(ctx, appID, &codegen.PaginateGroupsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+			if err != nil {
+				return 0, err
+			}
+			if resp.JSON200 == nil {
+				return 0, newAPIError(resp.HTTPResponse, resp.Body)
+			}
+			slots.set(page, resp.JSON200.Groups)
+			return resp.JSON200.TotalCount, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		groups := []codegen.Group{}
+		for _, items := range slots.ordered() {
+			groups = append(groups, items.([]codegen.Group)...)
+		}
+		return groups, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]codegen.Group), nil
+}
+
+// listPackages returns all the packages of the application.
+func (c *apiClient) listPackages(ctx context.Context, appID string) ([]codegen.Package, error) {
+	value, err := c.lists.get(listKindPackages, appID, func() (interface{}, error) {
+		var slots pageSlots
+		err := fetchAllPages(ctx, paginationPerPage, paginationParallelism, func(ctx context.Context, page, perPage int) (int, error) {
+			resp, err := c.client.PaginatePackagesWithResponse(ctx, appID, &codegen.PaginatePackagesParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+			if err != nil {
+				return 0, err
+			}
+			if resp.JSON200 == nil {
+				return 0, newAPIError(resp.HTTPResponse, resp.Body)
+			}
+			slots.set(page, resp.JSON200.Packages)
+			return resp.JSON200.TotalCount, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		packages := []codegen.Package{}
+		for _, items := range slots.ordered() {
+			packages = append(packages, items.([]codegen.Package)...)
+		}
+		return packages, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]codegen.Package), nil
+}
+
+// listApplications returns all the applications, it isn't cached.
+func (c *apiClient) listApplications(ctx context.Context) ([]codegen.Application, error) {
+	var slots pageSlots
+	err := fetchAllPages(ctx, paginationPerPage, paginationParallelism, func(ctx context.Context, page, perPage int) (int, error) {
+		resp, err := c.client.PaginateAppsWithResponse(ctx, &codegen.PaginateAppsParams{Page: &page, Perpage: &perPage}, c.reqEditors...)
+		if err != nil {
+			return 0, err
+		}
+		if resp.JSON200 == nil {
+			return 0, newAPIError(resp.HTTPResponse, resp.Body)
+		}
+		slots.set(page, resp.JSON200.Applications)
+		return resp.JSON200.TotalCount, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	apps := []codegen.Application{}
+	for _, items := range slots.ordered() {
+		apps = append(apps, items.([]codegen.Application)...)
+	}
+	return apps, nil
+}
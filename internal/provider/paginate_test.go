@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPageCount(t *testing.T) {
+	cases := []struct {
+		totalCount, perPage, want int
+	}{
+		{0, 10, 1},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{25, 10, 3},
+		{30, 10, 3},
+	}
+	for _, tc := range cases {
+		if got := pageCount(tc.totalCount, tc.perPage); got != tc.want {
+			t.Errorf("pageCount(%d, %d) = %d, want %d", tc.totalCount, tc.perPage, got, tc.want)
+		}
+	}
+}
+
+func TestFetchAllPages(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		fetched  = map[int]bool{}
+		inFlight int32
+		maxSeen  int32
+	)
+	err := fetchAllPages(context.Background(), 10, 3, func(ctx context.Context, page, perPage int) (int, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, n) {
+				break
+			}
+		}
+		mu.Lock()
+		fetched[page] = true
+		mu.Unlock()
+		return 95, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for page := 1; page <= 10; page++ {
+		if !fetched[page] {
+			t.Errorf("page %d wasn't fetched", page)
+		}
+	}
+	if len(fetched) != 10 {
+		t.Errorf("fetched %d pages, want 10", len(fetched))
+	}
+	if maxSeen > 3 {
+		t.Errorf("%d pages fetched concurrently, want at most 3", maxSeen)
+	}
+}
+
+func TestFetchAllPagesError(t *testing.T) {
+	errPage := errors.New("page failed")
+	err := fetchAllPages(context.Background(), 10, 2, func(ctx context.Context, page, perPage int) (int, error) {
+		if page == 3 {
+			return 0, errPage
+		}
+		return 100, nil
+	})
+	if err != errPage {
+		t.Fatalf("got error %v, want %v", err, errPage)
+	}
+}
+
+func TestListCache(t *testing.T) {
+	var lc listCache
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+
+	lc.get(listKindGroups, "app", load)
+	lc.get(listKindGroups, "app", load)
+	if loads != 1 {
+		t.Fatalf("listing loaded %d times, want 1", loads)
+	}
+
+	lc.invalidate(listKindGroups, "app")
+	if v, _ := lc.get(listKindGroups, "app", load); v.(int) != 2 {
+		t.Fatalf("got %v after invalidation, want a fresh listing", v)
+	}
+}
@@ -0,0 +1,194 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// activeInstancesDuration is the period in which instances must have checked
+// for updates to count as active, it matches the one Nebraska uses for the
+// instance counts of applications.
+const activeInstancesDuration = "1d"
+
+// checkDeletionProtection refuses to delete the object described by kind and
+// name when deletion protection applies to it and count reports active
+// instances.
+func checkDeletionProtection(d *schema.ResourceData, c *apiClient, kind string, name string, count func() (int, error)) diag.Diagnostics {
+	if !c.deletionProtection && !d.Get("deletion_protection").(bool) {
+		return nil
+	}
+	if d.Get("force_destroy").(bool) {
+		return nil
+	}
+
+	instances, err := count()
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't count the active instances of the %s", kind), err, errorAttrs{})}
+	}
+	if instances == 0 {
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("The %s has active instances", kind),
+		Detail: fmt.Sprintf("The %s %q has %d instances that checked for updates in the last day, destroying it would orphan them. "+
+			"Move the instances first, or set force_destroy = true and apply it before destroying the %s.", kind, name, instances, kind),
+		AttributePath: cty.GetAttrPath("force_destroy"),
+	}}
+}
+
+// groupInstancesCount returns the number of active instances of a group.
+func groupInstancesCount(ctx context.Context, c *apiClient, appID string, groupID string) (int, error) {
+	resp, err := c.client.GetGroupInstancesCountWithResponse(ctx, appID, groupID, &codegen.GetGroupInstancesCountParams{Duration: activeInstancesDuration}, c.reqEditors...)
+	if err == nil && resp.JSON200 == nil {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.JSON200.Count), nil
+}
+
+// applicationInstancesCount returns the number of active instances of an
+// application.
+func applicationInstancesCount(ctx context.Context, c *apiClient, appID string) (int, error) {
+	resp, err := c.client.GetAppWithResponse(ctx, appID, c.reqEditors...)
+	if err == nil && resp.JSON200 == nil {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return resp.JSON200.Instances.Count, nil
+}
+
+// confirmDestroy is the confirm_change token allowing to destroy a protected
+// channel or group.
+const confirmDestroy = "destroy"
+
+// localOnlyKeys are the attributes that don't change the object in Nebraska.
+var localOnlyKeys = map[string]bool{
+	"confirm_change":      true,
+	"deletion_protection": true,
+	"force_destroy":       true,
+	"rollout_impact":      true,
+}
+
+// compileNamePatterns compiles names or regular expressions, already
+// validated by the schema, into patterns matching whole names.
+func compileNamePatterns(patterns []string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, regexp.MustCompile("^(?:"+pattern+")$"))
+	}
+	return compiled
+}
+
+func matchesAny(patterns []*regexp.Regexp, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if pattern.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// customizeDiffChannelProtection fails the plan of changes to protected
+// channels without a new confirm_change token. When the package changes, the
+// token must be the version of the new package.
+func customizeDiffChannelProtection(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+	expected := ""
+	if d.HasChange("package_id") && d.NewValueKnown("package_id") {
+		if packageID := d.Get("package_id").(string); packageID != "" {
+			appID, _ := d.GetChange("application_id")
+			expected = packageVersion(ctx, c, appID.(string), packageID)
+		}
+	}
+	return checkProtectedChange(d, "channel", c.protectedChannels, expected, []string{"application_id", "arch"})
+}
+
+// customizeDiffGroupProtection fails the plan of changes to protected groups
+// without a new confirm_change token.
+func customizeDiffGroupProtection(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+	return checkProtectedChange(d, "group", c.protectedGroups, "", []string{"application_id"})
+}
+
+// checkProtectedChange requires changes to an object matching patterns to
+// come with a new confirm_change token, equal to expected when it's set.
+// Changing only the token is always allowed. Changing one of replaceKeys
+// replaces the object, which requires the confirmDestroy token applied
+// beforehand, as destroying it does. The confirmDestroy token doesn't confirm
+// other changes, so it doesn't stay set on an object that is kept.
+func checkProtectedChange(d *schema.ResourceDiff, kind string, patterns []*regexp.Regexp, expected string, replaceKeys []string) error {
+	if d.Id() == "" {
+		return nil
+	}
+	oldName, newName := d.GetChange("name")
+	if !matchesAny(patterns, oldName.(string), newName.(string)) {
+		return nil
+	}
+
+	for _, key := range replaceKeys {
+		if !d.HasChange(key) {
+			continue
+		}
+		if oldToken, _ := d.GetChange("confirm_change"); oldToken.(string) != confirmDestroy {
+			return fmt.Errorf("the %s %q is protected and changing %s replaces it, set confirm_change = %q and apply it before changing %s", kind, oldName, key, confirmDestroy, key)
+		}
+		return nil
+	}
+
+	changed := false
+	for _, key := range d.GetChangedKeysPrefix("") {
+		if !localOnlyKeys[key] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	token := d.Get("confirm_change").(string)
+	if !d.HasChange("confirm_change") || token == "" {
+		if expected != "" {
+			return fmt.Errorf("the %s %q is protected, set confirm_change to the target version %q to confirm this change", kind, oldName, expected)
+		}
+		return fmt.Errorf("the %s %q is protected, set confirm_change to a new value to confirm this change", kind, oldName)
+	}
+	if token == confirmDestroy {
+		return fmt.Errorf("the %s %q is protected, confirm_change = %q only confirms destroying it, set confirm_change to a new value to confirm this change", kind, oldName, confirmDestroy)
+	}
+	if expected != "" && token != expected {
+		return fmt.Errorf("the %s %q is protected, confirm_change is %q but must be the target version %q", kind, oldName, token, expected)
+	}
+	return nil
+}
+
+// checkProtectedDelete refuses to delete an object matching patterns unless
+// its confirm_change token was set to confirmDestroy beforehand.
+func checkProtectedDelete(d *schema.ResourceData, kind string, patterns []*regexp.Regexp) diag.Diagnostics {
+	name := d.Get("name").(string)
+	if !matchesAny(patterns, name) || d.Get("confirm_change").(string) == confirmDestroy {
+		return nil
+	}
+	return diag.Diagnostics{{
+		Severity:      diag.Error,
+		Summary:       fmt.Sprintf("The %s is protected", kind),
+		Detail:        fmt.Sprintf("The %s %q is protected, set confirm_change = %q and apply it before destroying the %s.", kind, name, confirmDestroy, kind),
+		AttributePath: cty.GetAttrPath("confirm_change"),
+	}}
+}
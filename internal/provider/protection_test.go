@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestResourceGroupDeleteProtection(t *testing.T) {
+	cases := []struct {
+		name               string
+		providerProtection bool
+		config             map[string]interface{}
+		instances          uint64
+		deleted            bool
+	}{
+		{"unprotected", false, map[string]interface{}{}, 10, true},
+		{"protected", false, map[string]interface{}{"deletion_protection": true}, 10, false},
+		{"protected by provider", true, map[string]interface{}{}, 10, false},
+		{"protected without instances", true, map[string]interface{}{}, 0, true},
+		{"forced", true, map[string]interface{}{"deletion_protection": true, "force_destroy": true}, 10, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, server := newDemoNebraska(t)
+			fake.groups[testAppID] = []codegen.Group{{Id: "grp-1", Name: "prod"}}
+			fake.instances["grp-1"] = tc.instances
+			c := newFakeClient(t, server, map[string]interface{}{"deletion_protection": tc.providerProtection})
+
+			tc.config["application_id"] = testAppID
+			tc.config["name"] = "prod"
+			d := schema.TestResourceDataRaw(t, resourceGroup().Schema, tc.config)
+			d.SetId("grp-1")
+
+			diags := resourceGroupDelete(context.Background(), d, c)
+			if deleted := len(fake.groups[testAppID]) == 0; deleted != tc.deleted {
+				t.Fatalf("got deleted %v, want %v, diagnostics: %#v", deleted, tc.deleted, diags)
+			}
+			if diags.HasError() == tc.deleted {
+				t.Fatalf("unexpected diagnostics: %#v", diags)
+			}
+		})
+	}
+}
+
+func TestResourceApplicationDeleteProtection(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.apps[0].Instances.Count = 3
+	c := newFakeClient(t, server, nil)
+
+	d := schema.TestResourceDataRaw(t, resourceApplication().Schema, map[string]interface{}{
+		"name":                "Demo",
+		"product_id":          "io.kinvolk.demo",
+		"deletion_protection": true,
+	})
+	d.SetId(testAppID)
+	if diags := resourceApplicationDelete(context.Background(), d, c); !diags.HasError() {
+		t.Fatalf("deleted an application with active instances")
+	}
+}
+
+func TestChannelProtection(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{{Id: "pkg-1", Version: "3510.2.1"}, {Id: "pkg-2", Version: "3510.2.2"}}
+	c := newFakeClient(t, server, map[string]interface{}{
+		"protected": []interface{}{map[string]interface{}{"channels": []interface{}{"stable", "prod-.*"}}},
+	})
+
+	cases := []struct {
+		name                string
+		channel, arch       string
+		packageID, oldToken string
+		newToken            string
+		err                 string
+	}{
+		{"unprotected", "beta", "amd64", "pkg-2", "", "", ""},
+		{"missing token", "stable", "amd64", "pkg-2", "", "", `set confirm_change to the target version "3510.2.2"`},
+		{"stale token", "stable", "amd64", "pkg-2", "3510.2.2", "3510.2.2", "set confirm_change to the target version"},
+		{"wrong token", "prod-eu", "amd64", "pkg-2", "", "3510.2.1", `must be the target version "3510.2.2"`},
+		{"confirmed", "stable", "amd64", "pkg-2", "3510.2.1", "3510.2.2", ""},
+		{"token only", "stable", "amd64", "pkg-1", "", "destroy", ""},
+		{"replace", "stable", "arm64", "pkg-1", "", "", `set confirm_change = "destroy" and apply it before changing arch`},
+		{"replace with destroy token", "stable", "arm64", "pkg-1", "3510.2.1", "destroy", `set confirm_change = "destroy" and apply it before changing arch`},
+		{"replace confirmed", "stable", "arm64", "pkg-1", "destroy", "destroy", ""},
+		{"destroy token", "stable", "amd64", "pkg-2", "3510.2.1", "destroy", `only confirms destroying it`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			state := &terraform.InstanceState{ID: "ch-1", Attributes: map[string]string{
+				"id":             "ch-1",
+				"name":           tc.channel,
+				"arch":           "amd64",
+				"application_id": testAppID,
+				"package_id":     "pkg-1",
+				"confirm_change": tc.oldToken,
+			}}
+			config := map[string]interface{}{
+				"name":           tc.channel,
+				"arch":           tc.arch,
+				"application_id": testAppID,
+				"package_id":     tc.packageID,
+			}
+			if tc.newToken != "" {
+				config["confirm_change"] = tc.newToken
+			}
+			_, err := resourceChannel().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), c)
+			if tc.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+				t.Fatalf("got error %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestProtectedGroupDelete(t *testing.T) {
+	c := &apiClient{protectedGroups: compileNamePatterns([]string{"prod-.*"})}
+	d := schema.TestResourceDataRaw(t, resourceGroup().Schema, map[string]interface{}{"name": "prod-eu"})
+	if diags := checkProtectedDelete(d, "group", c.protectedGroups); !diags.HasError() {
+		t.Fatalf("protected group can be deleted without confirmation")
+	}
+	d.Set("confirm_change", confirmDestroy)
+	if diags := checkProtectedDelete(d, "group", c.protectedGroups); diags.HasError() {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -65,18 +67,100 @@ func New(version string) func() *schema.Provider {
 					DefaultFunc: schema.EnvDefaultFunc("NEBRASKA_PASSWORD", ""),
 					Description: "The password used to authenticate when the auth_mode is `oidc`. Can be configured using the env variable `NEBRASKA_PASSWORD` ",
 				},
+				"default_application": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("NEBRASKA_DEFAULT_APPLICATION", ""),
+					ValidateFunc: validation.Any(validation.StringIsEmpty, validateApplicationID),
+					Description:  "The ID or product ID of the application used by resources and data sources that omit `application_id`. Can be configured using the env variable `NEBRASKA_DEFAULT_APPLICATION`.",
+				},
+				"max_requests_per_second": {
+					Type:         schema.TypeFloat,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("NEBRASKA_MAX_REQUESTS_PER_SECOND", 0),
+					ValidateFunc: validation.FloatAtLeast(0),
+					Description:  "The maximum number of requests per second sent to the Nebraska server, `0` means unlimited. Can be configured using the env variable `NEBRASKA_MAX_REQUESTS_PER_SECOND`.",
+				},
+				"max_concurrent_requests": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					DefaultFunc:  schema.EnvDefaultFunc("NEBRASKA_MAX_CONCURRENT_REQUESTS", 0),
+					ValidateFunc: validation.IntAtLeast(0),
+					Description:  "The maximum number of requests in flight to the Nebraska server, `0` means unlimited. Can be configured using the env variable `NEBRASKA_MAX_CONCURRENT_REQUESTS`.",
+				},
+				"deletion_protection": {
+					Type:        schema.TypeBool,
+					Optional:    true,
+					DefaultFunc: schema.EnvDefaultFunc("NEBRASKA_DELETION_PROTECTION", false),
+					Description: "Refuse to destroy any application or group with active instances, as if they all set `deletion_protection`. Can be configured using the env variable `NEBRASKA_DELETION_PROTECTION`.",
+				},
+				"group_policy_defaults": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					MaxItems:    1,
+					Description: "Defaults of the `policy_*` attributes of `nebraska_group` resources. A group's own attributes take precedence, then its `policy_preset`, then these defaults and finally the defaults of the `nebraska_group` schema.",
+					Elem: &schema.Resource{
+						Schema: groupPolicySchema(),
+					},
+				},
+				"group_policy_preset": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					Description: "A preset of `policy_*` attributes `nebraska_group` resources can select with `policy_preset`, it replaces a built-in preset of the same name.",
+					Elem: &schema.Resource{
+						Schema: groupPolicyPresetSchema(),
+					},
+				},
+				"protected": {
+					Type:        schema.TypeList,
+					Optional:    true,
+					MaxItems:    1,
+					Description: "Channels and groups that can only be changed or destroyed along with their `confirm_change` token.",
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"channels": {
+								Type:        schema.TypeList,
+								Optional:    true,
+								Description: "Names or regular expressions matching the whole name of the protected channels.",
+								Elem: &schema.Schema{
+									Type:         schema.TypeString,
+									ValidateFunc: validation.StringIsValidRegExp,
+								},
+							},
+							"groups": {
+								Type:        schema.TypeList,
+								Optional:    true,
+								Description: "Names or regular expressions matching the whole name of the protected groups.",
+								Elem: &schema.Schema{
+									Type:         schema.TypeString,
+									ValidateFunc: validation.StringIsValidRegExp,
+								},
+							},
+						},
+					},
+				},
 			},
 			DataSourcesMap: map[string]*schema.Resource{
-				"nebraska_application": dataSourceApplication(),
-				"nebraska_group":       dataSourceGroup(),
-				"nebraska_channel":     dataSourceChannel(),
-				"nebraska_package":     dataSourcePackage(),
+				"nebraska_application":      dataSourceApplication(),
+				"nebraska_audit":            dataSourceAudit(),
+				"nebraska_group":            dataSourceGroup(),
+				"nebraska_channel":          dataSourceChannel(),
+				"nebraska_package":          dataSourcePackage(),
+				"nebraska_package_usage":    dataSourcePackageUsage(),
+				"nebraska_flatcar_payload":  dataSourceFlatcarPayload(),
+				"nebraska_flatcar_releases": dataSourceFlatcarReleases(),
 			},
 			ResourcesMap: map[string]*schema.Resource{
-				"nebraska_application": resourceApplication(),
-				"nebraska_channel":     resourceChannel(),
-				"nebraska_group":       resourceGroup(),
-				"nebraska_package":     resourcePackage(),
+				"nebraska_application":          resourceApplication(),
+				"nebraska_channel":              resourceChannel(),
+				"nebraska_channel_set":          resourceChannelSet(),
+				"nebraska_group":                resourceGroup(),
+				"nebraska_package":              resourcePackage(),
+				"nebraska_package_set":          resourcePackageSet(),
+				"nebraska_package_retention":    resourcePackageRetention(),
+				"nebraska_rollout":              resourceRollout(),
+				"nebraska_update_freeze":        resourceUpdateFreeze(),
+				"nebraska_flatcar_release_sync": resourceFlatcarReleaseSync(),
 			},
 		}
 
@@ -90,6 +174,34 @@ type apiClient struct {
 	authMode   string
 	reqEditors []codegen.RequestEditorFn
 	client     *codegen.ClientWithResponses
+
+	// defaultApplicationID is the resolved ID of the provider's
+	// default_application, empty when it isn't configured.
+	defaultApplicationID string
+
+	// appIDs caches product ID to application ID lookups.
+	appIDsMu sync.Mutex
+	appIDs   map[string]string
+
+	// lists caches the paginated listings of applications.
+	lists listCache
+
+	// deletionProtection enables deletion protection for all applications
+	// and groups.
+	deletionProtection bool
+
+	// protectedChannels and protectedGroups match the names of the channels
+	// and groups requiring a confirm_change token to change.
+	protectedChannels []*regexp.Regexp
+	protectedGroups   []*regexp.Regexp
+
+	// groupPolicyDefaults are the values of the policy attributes groups
+	// omit.
+	groupPolicyDefaults map[string]interface{}
+
+	// groupPolicyPresets are the presets of policy attributes groups can
+	// select by name.
+	groupPolicyPresets map[string]map[string]interface{}
 }
 
 func configure(version string, p *schema.Provider) func(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
@@ -99,8 +211,9 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 		endpoint := d.Get("endpoint").(string)
 		authMode := d.Get("auth_mode").(string)
 
-		// setup client
-		client, err := codegen.NewClientWithResponses(endpoint)
+		// setup client, every request goes through the rate limited transport
+		transport := newRateLimitedTransport(http.DefaultTransport, d.Get("max_requests_per_second").(float64), d.Get("max_concurrent_requests").(int))
+		client, err := codegen.NewClientWithResponses(endpoint, codegen.WithHTTPClient(&http.Client{Transport: transport}))
 		if err != nil {
 			diags = append(diags, diag.Diagnostic{
 				Severity: diag.Error,
@@ -126,12 +239,11 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 		}
 
 		resp, err := client.GetConfigWithResponse(ctx, configRequestEditor...)
+		if err == nil && resp.JSON200 == nil {
+			err = newAPIError(resp.HTTPResponse, resp.Body)
+		}
 		if err != nil {
-			diags = append(diags, diag.Diagnostic{
-				Severity: diag.Error,
-				Summary:  "Config fetch",
-				Detail:   fmt.Sprintf("Couldn't fetch the nebraska server config: %v", err),
-			})
+			diags = append(diags, apiErrorDiag("Couldn't fetch the Nebraska server config", err, errorAttrs{}))
 			return nil, diags
 		}
 
@@ -145,12 +257,17 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 		}
 
 		apiClient := &apiClient{
-			authMode: authMode,
-			client:   client,
+			authMode:            authMode,
+			client:              client,
+			deletionProtection:  d.Get("deletion_protection").(bool),
+			groupPolicyDefaults: groupPolicyDefaults(d),
+			groupPolicyPresets:  groupPolicyPresets(d),
 		}
 
-		if authMode == "noop" {
-			return apiClient, diags
+		if protected, ok := d.Get("protected").([]interface{}); ok && len(protected) > 0 && protected[0] != nil {
+			m := protected[0].(map[string]interface{})
+			apiClient.protectedChannels = compileNamePatterns(arrInterfaceToarrString(m["channels"].([]interface{})))
+			apiClient.protectedGroups = compileNamePatterns(arrInterfaceToarrString(m["groups"].([]interface{})))
 		}
 
 		if authMode == "github" {
@@ -181,36 +298,48 @@ func configure(version string, p *schema.Provider) func(ctx context.Context, d *
 				return nil, diags
 			}
 
-			requestBody := fmt.Sprintf(`username=%s&password=%s`, url.QueryEscape(username), url.QueryEscape(password))
-			loginTokenResp, err := client.LoginTokenWithBodyWithResponse(ctx, "application/x-www-form-urlencoded", strings.NewReader(requestBody))
+			reqEditors, err := loginOIDC(ctx, client, username, password)
 			if err != nil {
-				diags = append(diags, diag.Diagnostic{
-					Severity: diag.Error,
-					Summary:  "Couldn't fetch login token",
-					Detail:   fmt.Sprintf("Login token error failed: %v", err),
-				})
-			}
-			if loginTokenResp.JSON200 == nil {
-				diags = append(diags, diag.Diagnostic{
-					Severity: diag.Error,
-					Summary:  "Couldn't fetch login token",
-					Detail:   fmt.Sprintf("Got non 200 status code: %v", loginTokenResp.StatusCode()),
-				})
+				diags = append(diags, apiErrorDiag("Couldn't fetch login token", err, errorAttrs{}))
+				return nil, diags
 			}
-			cookie := loginTokenResp.HTTPResponse.Header.Get("Set-Cookie")
-			apiClient.reqEditors = []codegen.RequestEditorFn{
-				newBearerTokenRequestEditor(loginTokenResp.JSON200.Token),
-				func(ctx context.Context, req *http.Request) error {
-					req.Header.Add("Cookie", cookie)
-					return nil
-				},
+			apiClient.reqEditors = reqEditors
+		}
+
+		if defaultApp := d.Get("default_application").(string); defaultApp != "" {
+			appID, err := apiClient.resolveApplicationID(ctx, defaultApp)
+			if err != nil {
+				diags = append(diags, apiErrorDiag("Couldn't resolve default_application", err, errorAttrs{application: "default_application"}))
+				return nil, diags
 			}
+			apiClient.defaultApplicationID = appID
 		}
 
 		return apiClient, diags
 	}
 }
 
+// loginOIDC exchanges the username and password for a login token and returns
+// the request editors authenticating the requests with it.
+func loginOIDC(ctx context.Context, client *codegen.ClientWithResponses, username, password string) ([]codegen.RequestEditorFn, error) {
+	requestBody := fmt.Sprintf(`username=%s&password=%s`, url.QueryEscape(username), url.QueryEscape(password))
+	loginTokenResp, err := client.LoginTokenWithBodyWithResponse(ctx, "application/x-www-form-urlencoded", strings.NewReader(requestBody))
+	if err == nil && loginTokenResp.JSON200 == nil {
+		err = newAPIError(loginTokenResp.HTTPResponse, loginTokenResp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("login token request failed: %w", err)
+	}
+	cookie := loginTokenResp.HTTPResponse.Header.Get("Set-Cookie")
+	return []codegen.RequestEditorFn{
+		newBearerTokenRequestEditor(loginTokenResp.JSON200.Token),
+		func(ctx context.Context, req *http.Request) error {
+			req.Header.Add("Cookie", cookie)
+			return nil
+		},
+	}, nil
+}
+
 func newBearerTokenRequestEditor(token string) codegen.RequestEditorFn {
 	if token == "" {
 		return nil
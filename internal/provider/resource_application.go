@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
 	"github.com/kinvolk/nebraska/backend/pkg/codegen"
 )
 
@@ -18,7 +19,22 @@ func resourceApplication() *schema.Resource {
 		ReadContext:   resourceApplicationRead,
 		UpdateContext: resourceApplicationUpdate,
 		DeleteContext: resourceApplicationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceApplicationImport,
+		},
 		Schema: map[string]*schema.Schema{
+			"deletion_protection": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Refuse to destroy the application while it has active instances, instances that checked for updates in the last day. Also enabled by the provider `deletion_protection`.",
+			},
+			"force_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Destroy the application even if it has active instances. It must be applied before the application is destroyed.",
+			},
 			"created_ts": {
 				Type:        schema.TypeString,
 				Description: "",
@@ -45,6 +61,29 @@ func resourceApplication() *schema.Resource {
 				ValidateFunc: validateProductID,
 				Required:     true,
 			},
+			"clone_from": {
+				Type:         schema.TypeString,
+				Description:  "ID or product ID of an application whose channels and groups are copied into this application when it is created. Cannot be changed once created.",
+				ValidateFunc: validateApplicationID,
+				Optional:     true,
+				ForceNew:     true,
+			},
+			"cloned_channel_ids": {
+				Type:        schema.TypeMap,
+				Description: "IDs of the channels copied by `clone_from`, keyed by `name/arch`, e.g. `stable/amd64`.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"cloned_group_ids": {
+				Type:        schema.TypeMap,
+				Description: "IDs of the groups copied by `clone_from`, keyed by name.",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
 		},
 	}
 }
@@ -77,6 +116,26 @@ func resourceApplicationRead(ctx context.Context, d *schema.ResourceData, meta i
 	return dataSourceApplicationRead(ctx, d, meta)
 }
 
+var applicationErrorAttrs = errorAttrs{unique: "product_id"}
+
+func resourceApplicationImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	c := meta.(*apiClient)
+
+	appResp, err := c.client.GetAppWithResponse(ctx, d.Id(), c.reqEditors...)
+	if err == nil && appResp.JSON200 == nil {
+		err = newAPIError(appResp.HTTPResponse, appResp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch application %q: %w", d.Id(), err)
+	}
+
+	d.SetId(appResp.JSON200.Id)
+	d.Set("deletion_protection", false)
+	d.Set("force_destroy", false)
+	appToResourceData(*appResp.JSON200, d)
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceApplicationCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	c := meta.(*apiClient)
@@ -92,25 +151,52 @@ func resourceApplicationCreate(ctx context.Context, d *schema.ResourceData, meta
 		})
 		return diags
 	}
-	app, err := c.client.CreateAppWithResponse(ctx, &codegen.CreateAppParams{}, codegen.CreateAppJSONRequestBody(*appConfig), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't create application",
-			Detail:   fmt.Sprintf("Got an error when creating application: %v", err),
-		})
-		return diags
+	params := &codegen.CreateAppParams{}
+	if cloneFrom, ok := d.GetOk("clone_from"); ok {
+		sourceID, err := c.resolveApplicationID(ctx, cloneFrom.(string))
+		if err != nil {
+			diags = append(diags, apiErrorDiag("Couldn't find application to clone", err, errorAttrs{application: "clone_from"}))
+			return diags
+		}
+		params.CloneFrom = &sourceID
+	}
+
+	app, err := c.client.CreateAppWithResponse(ctx, params, codegen.CreateAppJSONRequestBody(*appConfig), c.reqEditors...)
+	if err == nil && app.JSON200 == nil {
+		err = newAPIError(app.HTTPResponse, app.Body)
 	}
-	if app.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Couldn't create application", app.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't create application", err, applicationErrorAttrs))
 		return diags
 	}
 
 	d.SetId(app.JSON200.Id)
 	appToResourceData(*app.JSON200, d)
+	if params.CloneFrom != nil {
+		d.Set("cloned_channel_ids", channelIDsByName(app.JSON200.Channels))
+		d.Set("cloned_group_ids", groupIDsByName(app.JSON200.Groups))
+	}
 	return nil
 }
 
+// channelIDsByName maps the channels to their IDs, keyed by name/arch so that
+// the keys don't depend on the other channels.
+func channelIDsByName(channels []codegen.Channel) map[string]string {
+	ids := map[string]string{}
+	for _, channel := range channels {
+		ids[fmt.Sprintf("%s/%s", channel.Name, api.Arch(channel.Arch).String())] = channel.Id
+	}
+	return ids
+}
+
+func groupIDsByName(groups []codegen.Group) map[string]string {
+	ids := map[string]string{}
+	for _, group := range groups {
+		ids[group.Name] = group.Id
+	}
+	return ids
+}
+
 func resourceApplicationUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*apiClient)
 
@@ -128,16 +214,11 @@ func resourceApplicationUpdate(ctx context.Context, d *schema.ResourceData, meta
 		return diags
 	}
 	app, err := c.client.UpdateAppWithResponse(ctx, appID, codegen.UpdateAppJSONRequestBody(*appConfig), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't update application",
-			Detail:   fmt.Sprintf("Got an error when updating application: %v", err),
-		})
-		return diags
+	if err == nil && app.JSON200 == nil {
+		err = newAPIError(app.HTTPResponse, app.Body)
 	}
-	if app.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Couldn't update application", app.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't update application", err, applicationErrorAttrs))
 		return diags
 	}
 
@@ -152,10 +233,26 @@ func resourceApplicationDelete(ctx context.Context, d *schema.ResourceData, meta
 
 	var appID = d.Id()
 
-	_, err := c.client.DeleteAppWithResponse(ctx, appID, c.reqEditors...)
-	if err != nil {
-		return diag.FromErr(err)
+	diags := checkDeletionProtection(d, c, "application", d.Get("product_id").(string), func() (int, error) {
+		return applicationInstancesCount(ctx, c, appID)
+	})
+	if diags.HasError() {
+		return diags
 	}
 
+	resp, err := c.client.DeleteAppWithResponse(ctx, appID, c.reqEditors...)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	err = deleteErr(err, func() error {
+		appResp, err := c.client.GetAppWithResponse(ctx, appID, c.reqEditors...)
+		if err == nil && appResp.JSON200 == nil {
+			err = newAPIError(appResp.HTTPResponse, appResp.Body)
+		}
+		return err
+	})
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't delete application", err, errorAttrs{})}
+	}
 	return nil
 }
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestResourceApplicationCloneFrom(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-stable", Name: "stable", Arch: 1},
+		{Id: "ch-stable-arm", Name: "stable", Arch: 2},
+		{Id: "ch-beta", Name: "beta", Arch: 1},
+	}
+	fake.groups[testAppID] = []codegen.Group{{Id: "grp-prod", Name: "prod", ChannelID: "ch-stable"}}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceApplication()
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":       "Demo clone",
+		"product_id": "io.kinvolk.demo-clone",
+		"clone_from": "io.kinvolk.demo",
+	})
+	diff, err := r.SimpleDiff(context.Background(), &terraform.InstanceState{}, config, c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	state, diags := r.Apply(context.Background(), &terraform.InstanceState{}, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+
+	cloneID := state.ID
+	channels := fake.channels[cloneID]
+	if len(channels) != 3 || len(fake.groups[cloneID]) != 1 {
+		t.Fatalf("application wasn't cloned: %#v %#v", channels, fake.groups[cloneID])
+	}
+	want := map[string]string{
+		"cloned_channel_ids.%":              "3",
+		"cloned_channel_ids.stable/amd64":   channels[0].Id,
+		"cloned_channel_ids.stable/aarch64": channels[1].Id,
+		"cloned_channel_ids.beta/amd64":     channels[2].Id,
+		"cloned_group_ids.%":                "1",
+		"cloned_group_ids.prod":             fake.groups[cloneID][0].Id,
+	}
+	for key, value := range want {
+		if state.Attributes[key] != value {
+			t.Errorf("got %s = %q, want %q", key, state.Attributes[key], value)
+		}
+	}
+	if fake.groups[cloneID][0].ChannelID != channels[0].Id {
+		t.Errorf("cloned group uses channel %q, want %q", fake.groups[cloneID][0].ChannelID, channels[0].Id)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/kinvolk/nebraska/backend/pkg/codegen"
@@ -18,6 +19,10 @@ func resourceChannel() *schema.Resource {
 		ReadContext:   dataSourceChannelRead,
 		UpdateContext: resourceChannelUpdate,
 		DeleteContext: resourceChannelDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffChannelProtection, customizeDiffChannelRolloutImpact),
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceChannelImport,
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": {
@@ -34,10 +39,12 @@ func resourceChannel() *schema.Resource {
 				Description:  "Arch. Cannot be changed once created.",
 			},
 			"application_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "ID of the application this channel belongs to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this channel belongs to. Defaults to the provider `default_application`.",
 			},
 			"color": {
 				Type:        schema.TypeString,
@@ -55,15 +62,50 @@ func resourceChannel() *schema.Resource {
 				Optional:    true,
 				Description: "The id of the package this channel provides.",
 			},
+			"confirm_change": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Token confirming a change to a channel protected by the provider `protected` setting. Every change must come with a new token, the version of the new package when `package_id` changes. Set it to `destroy` and apply it before destroying or replacing the channel, it confirms no other change.",
+			},
+			"rollout_impact": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Summary of the updates a planned change of `package_id` rolls out to the groups using the channel, e.g. `this change will roll 1,240 instances in groups prod-eu, prod-us from 3510.2.1 to 3510.2.2`. It is only set in plans, applying the change clears it.",
+			},
 		},
 	}
 }
 
+var channelErrorAttrs = errorAttrs{application: "application_id", unique: "name"}
+
+func resourceChannelImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	c := meta.(*apiClient)
+
+	appID, channelID, err := parseImportID(ctx, c, d.Id())
+	if err != nil {
+		return nil, err
+	}
+	channelResp, err := c.client.GetChannelWithResponse(ctx, appID, channelID, c.reqEditors...)
+	if err == nil && channelResp.JSON200 == nil {
+		err = newAPIError(channelResp.HTTPResponse, channelResp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch channel %q: %w", channelID, err)
+	}
+
+	d.SetId(channelResp.JSON200.Id)
+	channelToResourceData(*channelResp.JSON200, d)
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceChannelCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*apiClient)
 
 	var diags diag.Diagnostics
-	appID := d.Get("application_id").(string)
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
 
 	channelConfig, err := resourceToChannelConfig(d)
 	if err != nil {
@@ -76,16 +118,12 @@ func resourceChannelCreate(ctx context.Context, d *schema.ResourceData, meta int
 	}
 
 	channel, err := c.client.CreateChannelWithResponse(ctx, appID, codegen.CreateChannelJSONRequestBody(*channelConfig), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't create channel",
-			Detail:   fmt.Sprintf("Got an error when creating channel: %v", err),
-		})
-		return diags
+	c.lists.invalidate(listKindChannels, appID)
+	if err == nil && channel.JSON200 == nil {
+		err = newAPIError(channel.HTTPResponse, channel.Body)
 	}
-	if channel.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Couldn't create channel", channel.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't create channel", err, channelErrorAttrs))
 		return diags
 	}
 
@@ -112,21 +150,19 @@ func resourceChannelUpdate(ctx context.Context, d *schema.ResourceData, meta int
 	}
 
 	channel, err := c.client.UpdateChannelWithResponse(ctx, appID, ID, codegen.UpdateChannelJSONRequestBody(*channelConfig), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't update channel",
-			Detail:   fmt.Sprintf("Got an error when updating channel: %v", err),
-		})
-		return diags
+	c.lists.invalidate(listKindChannels, appID)
+	if err == nil && channel.JSON200 == nil {
+		err = newAPIError(channel.HTTPResponse, channel.Body)
 	}
-	if channel.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Couldn't update channel", channel.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't update channel", err, channelErrorAttrs))
 		return diags
 	}
 
 	d.SetId(channel.JSON200.Id)
 	channelToResourceData(*channel.JSON200, d)
+	// rollout_impact only describes the planned change.
+	d.Set("rollout_impact", "")
 	return diags
 }
 
@@ -137,9 +173,24 @@ func resourceChannelDelete(ctx context.Context, d *schema.ResourceData, meta int
 	appID := d.Get("application_id").(string)
 	channelID := d.Id()
 
-	_, err := c.client.DeleteChannelWithResponse(ctx, appID, channelID, c.reqEditors...)
+	if diags := checkProtectedDelete(d, "channel", c.protectedChannels); diags.HasError() {
+		return diags
+	}
+
+	resp, err := c.client.DeleteChannelWithResponse(ctx, appID, channelID, c.reqEditors...)
+	c.lists.invalidate(listKindChannels, appID)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	err = deleteErr(err, func() error {
+		channelResp, err := c.client.GetChannelWithResponse(ctx, appID, channelID, c.reqEditors...)
+		if err == nil && channelResp.JSON200 == nil {
+			err = newAPIError(channelResp.HTTPResponse, channelResp.Body)
+		}
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diag.Diagnostics{apiErrorDiag("Couldn't delete channel", err, errorAttrs{application: "application_id"})}
 	}
 	return nil
 }
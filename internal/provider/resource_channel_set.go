@@ -0,0 +1,383 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+func resourceChannelSet() *schema.Resource {
+	return &schema.Resource{
+		Description: "Same-named channels for several architectures, e.g. the amd64 and aarch64 `stable` channels, each providing the package of a version for its arch. The packages must exist when planning.",
+
+		CreateContext: resourceChannelSetCreate,
+		ReadContext:   resourceChannelSetRead,
+		UpdateContext: resourceChannelSetUpdate,
+		DeleteContext: resourceChannelSetDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffChannelSetProtection, customizeDiffChannelSet),
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceChannelSetImport,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "Name of the channels. Cannot be changed once created.",
+			},
+			"arches": {
+				Type:     schema.TypeSet,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringInSlice([]string{"all", "amd64", "aarch64", "x86"}, false),
+				},
+				Description: "Arches of the channels.",
+			},
+			"version": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Version of the packages the channels provide, the package of each arch must exist. The channels provide no package when unset.",
+			},
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application the channels belong to. Defaults to the provider `default_application`.",
+			},
+			"color": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "Hex color code that informs the color of the channels in the UI.",
+			},
+			"confirm_change": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Token confirming a change to channels protected by the provider `protected` setting. Every change must come with a new token, the new version when `version` changes. Set it to `destroy` and apply it before destroying or replacing the channels, it confirms no other change.",
+			},
+			"channel_ids": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the channels by arch.",
+			},
+			"package_ids": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the packages the channels provide by arch.",
+			},
+		},
+	}
+}
+
+// customizeDiffChannelSetProtection fails the plan of changes to protected
+// channels without a new confirm_change token, the new version when the
+// version changes.
+func customizeDiffChannelSetProtection(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+	expected := ""
+	if d.HasChange("version") && d.NewValueKnown("version") {
+		expected = d.Get("version").(string)
+	}
+	return checkProtectedChange(d, "channel", c.protectedChannels, expected, []string{"application_id", "name"})
+}
+
+// customizeDiffChannelSet plans the package of each arch, failing when one is
+// missing, and the channel_ids when arches are added or removed.
+func customizeDiffChannelSet(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+
+	if !d.NewValueKnown("arches") {
+		if err := d.SetNewComputed("channel_ids"); err != nil {
+			return err
+		}
+		return d.SetNewComputed("package_ids")
+	}
+	arches := arrInterfaceToarrString(d.Get("arches").(*schema.Set).List())
+	sort.Strings(arches)
+
+	channelIDs := d.Get("channel_ids").(map[string]interface{})
+	changed := len(channelIDs) != len(arches)
+	for _, arch := range arches {
+		if _, ok := channelIDs[arch]; !ok {
+			changed = true
+		}
+	}
+	if changed {
+		if err := d.SetNewComputed("channel_ids"); err != nil {
+			return err
+		}
+	}
+
+	if !d.NewValueKnown("version") || !d.NewValueKnown("application_id") {
+		return d.SetNewComputed("package_ids")
+	}
+	appRef := d.Get("application_id").(string)
+	if appRef == "" {
+		appRef = c.defaultApplicationID
+	}
+	if appRef == "" {
+		// applying fails with the missing application.
+		return nil
+	}
+	appID, err := c.resolveApplicationID(ctx, appRef)
+	if err != nil {
+		return err
+	}
+	packageIDs, err := channelSetPackages(ctx, c, appID, d.Get("version").(string), arches)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(packageIDs) != fmt.Sprint(d.Get("package_ids")) {
+		return d.SetNew("package_ids", packageIDs)
+	}
+	return nil
+}
+
+// channelSetPackages returns the IDs of the packages of version by arch,
+// failing when an arch lacks the package. There are no packages when version
+// is empty.
+func channelSetPackages(ctx context.Context, c *apiClient, appID string, version string, arches []string) (map[string]interface{}, error) {
+	packageIDs := map[string]interface{}{}
+	if version == "" {
+		return packageIDs, nil
+	}
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch packages: %w", err)
+	}
+	var missing []string
+	for _, arch := range arches {
+		pkg := filterPackageByVersionArch(packages, version, arch)
+		if pkg == nil {
+			missing = append(missing, arch)
+			continue
+		}
+		packageIDs[arch] = pkg.Id
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no package of version %q for arch %s", version, strings.Join(missing, ", "))
+	}
+	return packageIDs, nil
+}
+
+// channelSetMember returns the nebraska_channel data of the channel of arch of
+// the set d, the channel has the ID id unless it's yet to be created.
+func channelSetMember(d *schema.ResourceData, appID string, id string, arch string, packageID string) *schema.ResourceData {
+	m := resourceChannel().Data(&terraform.InstanceState{ID: id})
+	m.Set("application_id", appID)
+	m.Set("name", d.Get("name"))
+	m.Set("arch", arch)
+	m.Set("color", d.Get("color"))
+	m.Set("package_id", packageID)
+	// the changes were confirmed when planning.
+	m.Set("confirm_change", confirmDestroy)
+	return m
+}
+
+func resourceChannelSetImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	c := meta.(*apiClient)
+
+	appID, name, err := parseImportID(ctx, c, d.Id())
+	if err != nil {
+		return nil, err
+	}
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch channels: %w", err)
+	}
+	channelIDs := map[string]interface{}{}
+	var arches []interface{}
+	versions := map[string]bool{}
+	for _, channel := range channels {
+		if channel.Name == name {
+			arch := api.Arch(channel.Arch).String()
+			channelIDs[arch] = channel.Id
+			arches = append(arches, arch)
+			version := ""
+			if channel.PackageID != "" {
+				version = packageVersion(ctx, c, appID, channel.PackageID)
+			}
+			versions[version] = true
+		}
+	}
+	if len(channelIDs) == 0 {
+		return nil, fmt.Errorf("no channel named %q found", name)
+	}
+	// the version is only known when all the channels provide it.
+	if len(versions) == 1 {
+		for version := range versions {
+			d.Set("version", version)
+		}
+	}
+
+	d.SetId(appID + "/" + name)
+	d.Set("application_id", appID)
+	d.Set("name", name)
+	d.Set("arches", arches)
+	d.Set("channel_ids", channelIDs)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceChannelSetRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	channels, err := c.listChannels(ctx, appID)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"})}
+	}
+
+	channelIDs := map[string]interface{}{}
+	packageIDs := map[string]interface{}{}
+	for arch, id := range d.Get("channel_ids").(map[string]interface{}) {
+		for _, channel := range channels {
+			if channel.Id != id.(string) {
+				continue
+			}
+			d.Set("color", channel.Color)
+			channelIDs[arch] = channel.Id
+			if channel.PackageID != "" {
+				packageIDs[arch] = channel.PackageID
+			}
+		}
+	}
+	// the channels deleted outside of Terraform are created again, the set
+	// is gone with all of them.
+	if len(channelIDs) == 0 {
+		d.SetId("")
+		return nil
+	}
+	d.Set("channel_ids", channelIDs)
+	d.Set("package_ids", packageIDs)
+	return nil
+}
+
+func resourceChannelSetCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	d.SetId(appID + "/" + d.Get("name").(string))
+	return resourceChannelSetApply(ctx, d, c, appID, map[string]interface{}{})
+}
+
+func resourceChannelSetUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	// the planned channel_ids are unknown, start from the created ones.
+	old, _ := d.GetChange("channel_ids")
+	channelIDs := map[string]interface{}{}
+	for arch, id := range old.(map[string]interface{}) {
+		channelIDs[arch] = id
+	}
+	return resourceChannelSetApply(ctx, d, c, d.Get("application_id").(string), channelIDs)
+}
+
+// resourceChannelSetApply creates or updates the channel of each arch of d,
+// and deletes the channels in channelIDs of the other arches.
+func resourceChannelSetApply(ctx context.Context, d *schema.ResourceData, c *apiClient, appID string, channelIDs map[string]interface{}) diag.Diagnostics {
+	// record the channels created before a failure, destroying the set
+	// deletes them instead of leaving them behind.
+	defer d.Set("channel_ids", channelIDs)
+
+	arches := arrInterfaceToarrString(d.Get("arches").(*schema.Set).List())
+	sort.Strings(arches)
+	packageIDs, err := channelSetPackages(ctx, c, appID, d.Get("version").(string), arches)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Package not found",
+			Detail:   err.Error(),
+		}}
+	}
+
+	oldPackageIDs, _ := d.GetChange("package_ids")
+	selected := map[string]bool{}
+	for _, arch := range arches {
+		selected[arch] = true
+		packageID, _ := packageIDs[arch].(string)
+		id, ok := channelIDs[arch]
+		if !ok {
+			m := channelSetMember(d, appID, "", arch, packageID)
+			if diags := resourceChannelCreate(ctx, m, c); diags.HasError() {
+				return archDiags(diags, arch)
+			}
+			channelIDs[arch] = m.Id()
+			d.Set("color", m.Get("color"))
+			continue
+		}
+		oldPackageID, _ := oldPackageIDs.(map[string]interface{})[arch].(string)
+		if !d.HasChange("color") && oldPackageID == packageID {
+			continue
+		}
+		m := channelSetMember(d, appID, id.(string), arch, packageID)
+		if diags := resourceChannelUpdate(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		d.Set("color", m.Get("color"))
+	}
+
+	var removed []string
+	for arch := range channelIDs {
+		if !selected[arch] {
+			removed = append(removed, arch)
+		}
+	}
+	sort.Strings(removed)
+	for _, arch := range removed {
+		m := channelSetMember(d, appID, channelIDs[arch].(string), arch, "")
+		if diags := resourceChannelDelete(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		delete(channelIDs, arch)
+	}
+	d.Set("package_ids", packageIDs)
+	return nil
+}
+
+func resourceChannelSetDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	if diags := checkProtectedDelete(d, "channel", c.protectedChannels); diags.HasError() {
+		return diags
+	}
+
+	channelIDs := d.Get("channel_ids").(map[string]interface{})
+	defer d.Set("channel_ids", channelIDs)
+	arches := make([]string, 0, len(channelIDs))
+	for arch := range channelIDs {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	for _, arch := range arches {
+		m := channelSetMember(d, appID, channelIDs[arch].(string), arch, "")
+		if diags := resourceChannelDelete(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		delete(channelIDs, arch)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestChannelSet(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{
+		{Id: "pkg-amd64-1", Version: "3510.2.1", Arch: 1},
+		{Id: "pkg-aarch64-1", Version: "3510.2.1", Arch: 2},
+		{Id: "pkg-amd64-2", Version: "3510.2.2", Arch: 1},
+	}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceChannelSet()
+	plan := func(t *testing.T, state *terraform.InstanceState, version string, arches ...interface{}) (*terraform.InstanceDiff, error) {
+		config := map[string]interface{}{
+			"application_id": "io.kinvolk.demo",
+			"name":           "stable",
+			"arches":         arches,
+			"version":        version,
+		}
+		return r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(config), c)
+	}
+	apply := func(t *testing.T, state *terraform.InstanceState, version string, arches ...interface{}) (*terraform.InstanceState, diag.Diagnostics) {
+		diff, err := plan(t, state, version, arches...)
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		return r.Apply(context.Background(), state, diff, c)
+	}
+
+	state, diags := apply(t, &terraform.InstanceState{}, "3510.2.1", "amd64", "aarch64")
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	channels := fake.channels[testAppID]
+	if len(channels) != 2 || state.ID != testAppID+"/stable" {
+		t.Fatalf("got channels %#v, state %#v", channels, state)
+	}
+	for _, channel := range channels {
+		arch := map[codegen.Arch]string{1: "amd64", 2: "aarch64"}[channel.Arch]
+		if channel.Name != "stable" || state.Attributes["channel_ids."+arch] != channel.Id || channel.PackageID != "pkg-"+arch+"-1" {
+			t.Errorf("unexpected channel %#v, state %v", channel, state.Attributes)
+		}
+	}
+
+	// aarch64 lacks the package of 3510.2.2.
+	if _, err := plan(t, state, "3510.2.2", "amd64", "aarch64"); err == nil || !strings.Contains(err.Error(), `no package of version "3510.2.2" for arch aarch64`) {
+		t.Fatalf("got error %v", err)
+	}
+
+	// the aarch64 channel is deleted, the amd64 one moved to 3510.2.2.
+	state, diags = apply(t, state, "3510.2.2", "amd64")
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	channels = fake.channels[testAppID]
+	if len(channels) != 1 || channels[0].PackageID != "pkg-amd64-2" || state.Attributes["package_ids.amd64"] != "pkg-amd64-2" {
+		t.Fatalf("got channels %#v, state %v", channels, state.Attributes)
+	}
+
+	// a package changed outside of Terraform is planned back.
+	fake.channels[testAppID][0].PackageID = "pkg-amd64-1"
+	c.lists.invalidate(listKindChannels, testAppID)
+	state, diags = r.RefreshWithoutUpgrade(context.Background(), state, c)
+	if diags.HasError() {
+		t.Fatalf("refresh failed: %#v", diags)
+	}
+	diff, err := plan(t, state, "3510.2.2", "amd64")
+	if err != nil || diff == nil || diff.Attributes["package_ids.amd64"] == nil || diff.Attributes["package_ids.amd64"].New != "pkg-amd64-2" {
+		t.Fatalf("got diff %#v, error %v", diff, err)
+	}
+
+	if _, diags := r.Apply(context.Background(), state, &terraform.InstanceDiff{Destroy: true}, c); diags.HasError() || len(fake.channels[testAppID]) != 0 {
+		t.Fatalf("destroy failed: %#v %#v", diags, fake.channels[testAppID])
+	}
+}
@@ -0,0 +1,332 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func resourceFlatcarReleaseSync() *schema.Resource {
+	s := flatcarFeedSchema()
+	s["application_id"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		Computed:     true,
+		ForceNew:     true,
+		ValidateFunc: validateApplicationID,
+		Description:  "ID or product ID of the application the packages belong to. Defaults to the provider `default_application`.",
+	}
+	s["prune"] = &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "Delete the packages the sync created for releases that are no longer selected, and all of them on destroy. Adopted packages and packages a channel points to are never deleted.",
+	}
+	s["releases"] = &schema.Schema{
+		Type:        schema.TypeList,
+		Computed:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "The selected releases, as `<version>/<arch>`.",
+	}
+	s["packages"] = &schema.Schema{
+		Type:        schema.TypeMap,
+		Computed:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "The IDs of the synced packages by `<version>/<arch>`.",
+	}
+	s["adopted_package_ids"] = &schema.Schema{
+		Type:        schema.TypeSet,
+		Computed:    true,
+		Elem:        &schema.Schema{Type: schema.TypeString},
+		Description: "The IDs of the synced packages that existed before the sync adopted them, `prune` never deletes them.",
+	}
+
+	return &schema.Resource{
+		Description: "Keeps the packages of an application in sync with the releases of a Flatcar release metadata JSON feed, see the `nebraska_flatcar_releases` data source. A package is created for each selected release and architecture, or adopted when the application already has a package of that version and arch, `prune` never deletes adopted packages. The feed must publish the payload sizes and hashes of the selected releases.",
+
+		CreateContext: resourceFlatcarReleaseSyncApply,
+		ReadContext:   resourceFlatcarReleaseSyncRead,
+		UpdateContext: resourceFlatcarReleaseSyncApply,
+		DeleteContext: resourceFlatcarReleaseSyncDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffFlatcarReleaseSync),
+
+		Schema: s,
+	}
+}
+
+// flatcarFeedKeys are the arguments of the feed, the releases are planned
+// once they're all known.
+var flatcarFeedKeys = []string{"url", "file", "payload_url_template", "channels", "arches", "min_version", "latest"}
+
+// customizeDiffFlatcarReleaseSync plans the releases selected from the feed,
+// and the packages when releases need to be synced or forgotten.
+func customizeDiffFlatcarReleaseSync(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	for _, key := range flatcarFeedKeys {
+		if !d.NewValueKnown(key) {
+			for _, key := range []string{"releases", "packages"} {
+				if err := d.SetNewComputed(key); err != nil {
+					return err
+				}
+			}
+			return d.SetNewComputed("adopted_package_ids")
+		}
+	}
+
+	releases, err := flatcarReleases(ctx, flatcarFeedOptionsFrom(d.Get))
+	if err != nil {
+		return fmt.Errorf("couldn't read the Flatcar release feed: %w", err)
+	}
+	if err := checkFlatcarPayloads(releases); err != nil {
+		return err
+	}
+	keys := make([]interface{}, 0, len(releases))
+	selected := map[string]bool{}
+	for _, r := range releases {
+		keys = append(keys, r.key())
+		selected[r.key()] = true
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(d.Get("releases")) {
+		if err := d.SetNew("releases", keys); err != nil {
+			return err
+		}
+	}
+
+	packages := d.Get("packages").(map[string]interface{})
+	changed := len(packages) != len(selected)
+	for key := range selected {
+		if _, ok := packages[key]; !ok {
+			changed = true
+		}
+	}
+	if changed {
+		if err := d.SetNewComputed("packages"); err != nil {
+			return err
+		}
+		return d.SetNewComputed("adopted_package_ids")
+	}
+	return nil
+}
+
+// checkFlatcarPayloads fails for releases whose feed doesn't publish the
+// payload size and hashes Nebraska clients check.
+func checkFlatcarPayloads(releases []flatcarRelease) error {
+	var missing []string
+	for _, r := range releases {
+		if r.Size == "" || r.Hash == "" || r.SHA256 == "" {
+			missing = append(missing, r.key())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the feed doesn't publish the payload size, sha1 and sha256 of %s, add them to the payloads of the releases or narrow the selection", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func resourceFlatcarReleaseSyncRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	packages, err := c.listPackages(ctx, appID)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch packages", err, errorAttrs{application: "application_id"})}
+	}
+	ids := map[string]bool{}
+	for _, pkg := range packages {
+		ids[pkg.Id] = true
+	}
+
+	// forget the packages deleted outside of Terraform, they're synced again.
+	synced := map[string]interface{}{}
+	for key, id := range d.Get("packages").(map[string]interface{}) {
+		if ids[id.(string)] {
+			synced[key] = id
+		}
+	}
+	adopted := []string{}
+	for _, id := range d.Get("adopted_package_ids").(*schema.Set).List() {
+		if ids[id.(string)] {
+			adopted = append(adopted, id.(string))
+		}
+	}
+	d.Set("packages", synced)
+	d.Set("adopted_package_ids", adopted)
+	return nil
+}
+
+func resourceFlatcarReleaseSyncApply(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	if d.Id() == "" {
+		d.SetId(appID + "/" + flatcarReleaseSyncHash(d))
+	}
+	d.Set("application_id", appID)
+
+	releases, err := flatcarReleases(ctx, flatcarFeedOptionsFrom(d.Get))
+	if err == nil {
+		err = checkFlatcarPayloads(releases)
+	}
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Couldn't read the Flatcar release feed",
+			Detail:   err.Error(),
+		}}
+	}
+
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch packages", err, errorAttrs{application: "application_id"})}
+	}
+	existing := map[string]string{}
+	for _, pkg := range packages {
+		existing[pkg.Version+"/"+api.Arch(pkg.Arch).String()] = pkg.Id
+	}
+
+	// the planned packages are unknown, start from the synced ones.
+	old, _ := d.GetChange("packages")
+	synced := map[string]interface{}{}
+	for key, id := range old.(map[string]interface{}) {
+		synced[key] = id
+	}
+	oldAdopted, _ := d.GetChange("adopted_package_ids")
+	adopted := map[string]bool{}
+	for _, id := range oldAdopted.(*schema.Set).List() {
+		adopted[id.(string)] = true
+	}
+	// record the packages synced or pruned before a failure, the next apply
+	// carries on from there instead of adopting its own packages.
+	defer func() {
+		d.Set("packages", synced)
+		ids := []string{}
+		for _, id := range synced {
+			if adopted[id.(string)] {
+				ids = append(ids, id.(string))
+			}
+		}
+		d.Set("adopted_package_ids", ids)
+	}()
+	defer c.lists.invalidate(listKindPackages, appID)
+
+	keys := make([]string, 0, len(releases))
+	selected := map[string]bool{}
+	for _, r := range releases {
+		keys = append(keys, r.key())
+		selected[r.key()] = true
+		if id, ok := existing[r.key()]; ok {
+			if synced[r.key()] != id {
+				adopted[id] = true
+			}
+			synced[r.key()] = id
+			continue
+		}
+		id, err := createFlatcarReleasePackage(ctx, c, appID, r)
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't create package %s", r.key()), err, packageErrorAttrs)}
+		}
+		synced[r.key()] = id
+	}
+	d.Set("releases", keys)
+
+	var pruned []string
+	for key := range synced {
+		if !selected[key] {
+			pruned = append(pruned, key)
+		}
+	}
+	sort.Strings(pruned)
+	for _, key := range pruned {
+		if d.Get("prune").(bool) && !adopted[synced[key].(string)] {
+			if diags := deleteUnusedPackage(ctx, c, appID, synced[key].(string)); diags.HasError() {
+				return diags
+			}
+		}
+		delete(synced, key)
+	}
+	return nil
+}
+
+// flatcarReleaseSyncHash returns a hash of the feed and of the channels and
+// arches selected from it, the syncs of an application have distinct IDs.
+func flatcarReleaseSyncHash(d *schema.ResourceData) string {
+	opts := flatcarFeedOptionsFrom(d.Get)
+	sort.Strings(opts.Channels)
+	sort.Strings(opts.Arches)
+	selection, _ := json.Marshal([]interface{}{opts.URL, opts.File, opts.Channels, opts.Arches})
+	sum := sha256.Sum256(selection)
+	return hex.EncodeToString(sum[:])
+}
+
+func resourceFlatcarReleaseSyncDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	if !d.Get("prune").(bool) {
+		return nil
+	}
+
+	appID := d.Get("application_id").(string)
+	defer c.lists.invalidate(listKindPackages, appID)
+	synced := d.Get("packages").(map[string]interface{})
+	adopted := d.Get("adopted_package_ids").(*schema.Set)
+	keys := make([]string, 0, len(synced))
+	for key, id := range synced {
+		if !adopted.Contains(id) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if diags := deleteUnusedPackage(ctx, c, appID, synced[key].(string)); diags.HasError() {
+			return diags
+		}
+	}
+	return nil
+}
+
+// createFlatcarReleasePackage creates the package of release r and returns its
+// ID.
+func createFlatcarReleasePackage(ctx context.Context, c *apiClient, appID string, r flatcarRelease) (string, error) {
+	arch, err := api.ArchFromString(r.Arch)
+	if err != nil {
+		return "", err
+	}
+	sha256 := r.SHA256
+	packageResp, err := c.client.CreatePackageWithResponse(ctx, appID, codegen.CreatePackageJSONRequestBody{
+		ApplicationId:     appID,
+		Arch:              int(arch),
+		ChannelsBlacklist: []string{},
+		Description:       fmt.Sprintf("Flatcar %s %s", r.Channel, r.Version),
+		Filename:          r.Filename,
+		Hash:              r.Hash,
+		Size:              r.Size,
+		Type:              int(PackageTypeFlatcar),
+		Url:               r.URL,
+		Version:           r.Version,
+		FlatcarAction: &codegen.FlatcarActionPackage{
+			Sha256: &sha256,
+		},
+	}, c.reqEditors...)
+	if err == nil && packageResp.JSON200 == nil {
+		err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
+	}
+	if err != nil {
+		return "", err
+	}
+	return packageResp.JSON200.Id, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/kinvolk/nebraska/backend/pkg/codegen"
@@ -18,8 +19,24 @@ func resourceGroup() *schema.Resource {
 		ReadContext:   dataSourceGroupRead,
 		UpdateContext: resourceGroupUpdate,
 		DeleteContext: resourceGroupDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffGroupPolicyDefaults, customizeDiffGroupProtection, customizeDiffGroupRolloutImpact),
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceGroupImport,
+		},
 
 		Schema: map[string]*schema.Schema{
+			"deletion_protection": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Refuse to destroy the group while it has active instances, instances that checked for updates in the last day. Also enabled by the provider `deletion_protection`.",
+			},
+			"force_destroy": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Destroy the group even if it has active instances. It must be applied before the group is destroyed.",
+			},
 			"name": {
 				Type:         schema.TypeString,
 				Required:     true,
@@ -33,10 +50,12 @@ func resourceGroup() *schema.Resource {
 				Description: "Identifier for clients, filled with the group ID if omitted.",
 			},
 			"application_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "ID of the application this group belongs to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this group belongs to. Defaults to the provider `default_application`.",
 			},
 			"description": {
 				Type:        schema.TypeString,
@@ -48,6 +67,16 @@ func resourceGroup() *schema.Resource {
 				Computed:    true,
 				Description: "Creation timestamp",
 			},
+			"confirm_change": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Token confirming a change to a group protected by the provider `protected` setting. Every change must come with a new token. Set it to `destroy` and apply it before destroying or replacing the group, it confirms no other change.",
+			},
+			"rollout_impact": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Summary of the updates a planned change enabling updates or changing `channel_id` rolls out, e.g. `this change will roll 310 instances in group prod-eu to 3510.2.2`. It is only set in plans, applying the change clears it.",
+			},
 			"rollout_in_progress": {
 				Type:        schema.TypeBool,
 				Computed:    true,
@@ -58,73 +87,110 @@ func resourceGroup() *schema.Resource {
 				Optional:    true,
 				Description: "The channel this group provides.",
 			},
+			"policy_preset": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Name of a preset of `policy_*` attributes, the `policy_*` attributes set on the group override it. Built-in presets are `canary` (safe mode, 1 update per hour), `bulk` (50 updates per 10 minutes during office hours) and `paused` (updates disabled), more can be declared with the provider `group_policy_preset`.",
+			},
 			"policy_updates_enabled": {
 				Type:        schema.TypeBool,
 				Optional:    true,
-				Default:     false,
-				Description: "Enable updates.",
+				Computed:    true,
+				Description: "Enable updates. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `false`.",
 			},
 			"policy_safe_mode": {
 				Type:        schema.TypeBool,
 				Optional:    true,
-				Default:     false,
-				Description: "Safe mode will only update 1 instance at a time, and stop if an update fails.",
+				Computed:    true,
+				Description: "Safe mode will only update 1 instance at a time, and stop if an update fails. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `false`.",
 			},
 			"policy_office_hours": {
 				Type:        schema.TypeBool,
 				Optional:    true,
-				Default:     false,
-				Description: "Only update between 9am and 5pm.",
+				Computed:    true,
+				Description: "Only update between 9am and 5pm. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `false`.",
 			},
 			"policy_timezone": {
 				Type:        schema.TypeString,
 				Optional:    true,
-				Default:     "Asia/Calcutta",
-				Description: "Timezone used to inform `policy_office_hours`.",
+				Computed:    true,
+				Description: "Timezone used to inform `policy_office_hours`. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `Asia/Calcutta`.",
 			},
 			"policy_period_interval": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				Default:     "1 hours",
-				Description: "Period used in combination with `policy_max_updates_per_period`.",
+				Type:                  schema.TypeString,
+				Optional:              true,
+				Computed:              true,
+				ValidateFunc:          validateInterval,
+				DiffSuppressFunc:      suppressEquivalentInterval,
+				DiffSuppressOnRefresh: true,
+				Description:           "Period used in combination with `policy_max_updates_per_period`. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `1 hours`.",
 			},
 			"policy_max_updates_per_period": {
 				Type:        schema.TypeInt,
 				Optional:    true,
-				Default:     1,
-				Description: "The maximum number of updates that can be performed within the `policy_period_interval`.",
+				Computed:    true,
+				Description: "The maximum number of updates that can be performed within the `policy_period_interval`. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `1`.",
 			},
 			"policy_update_timeout": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				Default:     "1 days",
-				Description: "Timeout for updates",
+				Type:                  schema.TypeString,
+				Optional:              true,
+				Computed:              true,
+				ValidateFunc:          validateInterval,
+				DiffSuppressFunc:      suppressEquivalentInterval,
+				DiffSuppressOnRefresh: true,
+				Description:           "Timeout for updates. Defaults to the `policy_preset`, then the provider `group_policy_defaults`, then `1 days`.",
 			},
 		},
 	}
 }
 
-func resourceGroupCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+var groupErrorAttrs = errorAttrs{application: "application_id", unique: "name"}
 
+func resourceGroupImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
 	c := meta.(*apiClient)
 
-	applicationID := d.Get("application_id").(string)
+	appID, groupID, err := parseImportID(ctx, c, d.Id())
+	if err != nil {
+		return nil, err
+	}
+	groupResp, err := c.client.GetGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+	if err == nil && groupResp.JSON200 == nil {
+		err = newAPIError(groupResp.HTTPResponse, groupResp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch group %q: %w", groupID, err)
+	}
 
-	var diags diag.Diagnostics
-	groupConfig := resourceToGroupConfig(d)
+	d.SetId(groupResp.JSON200.Id)
+	d.Set("application_id", appID)
+	d.Set("deletion_protection", false)
+	d.Set("force_destroy", false)
+	groupToResourceData(*groupResp.JSON200, d)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceGroupCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+
+	c := meta.(*apiClient)
 
-	group, err := c.client.CreateGroupWithResponse(ctx, applicationID, codegen.CreateGroupJSONRequestBody(*groupConfig), c.reqEditors...)
+	appID, err := applicationID(ctx, d, c)
 	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't create group",
-			Detail:   fmt.Sprintf("Got an error when creating group: %v", err),
-		})
+		return applicationIDDiag(err)
+	}
+
+	if diags := fillGroupPolicy(c, d); diags.HasError() {
 		return diags
 	}
+	var diags diag.Diagnostics
+	groupConfig := resourceToGroupConfig(d)
 
-	if group.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Creating group", group.HTTPResponse))
+	group, err := c.client.CreateGroupWithResponse(ctx, appID, codegen.CreateGroupJSONRequestBody(*groupConfig), c.reqEditors...)
+	c.lists.invalidate(listKindGroups, appID)
+	if err == nil && group.JSON200 == nil {
+		err = newAPIError(group.HTTPResponse, group.Body)
+	}
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't create group", err, groupErrorAttrs))
 		return diags
 	}
 
@@ -139,26 +205,26 @@ func resourceGroupUpdate(ctx context.Context, d *schema.ResourceData, meta inter
 
 	applicationID := d.Get("application_id").(string)
 
+	if diags := fillGroupPolicy(c, d); diags.HasError() {
+		return diags
+	}
 	var diags diag.Diagnostics
 	groupConfig := resourceToGroupConfig(d)
 
 	group, err := c.client.UpdateGroupWithResponse(ctx, applicationID, d.Id(), codegen.UpdateGroupJSONRequestBody(*groupConfig), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't update group",
-			Detail:   fmt.Sprintf("Got an error when updating group: %q error:%v", d.Id(), err),
-		})
-		return diags
+	c.lists.invalidate(listKindGroups, applicationID)
+	if err == nil && group.JSON200 == nil {
+		err = newAPIError(group.HTTPResponse, group.Body)
 	}
-
-	if group.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Updating group", group.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't update group", err, groupErrorAttrs))
 		return diags
 	}
 
 	d.SetId(group.JSON200.Id)
 	groupToResourceData(*group.JSON200, d)
+	// rollout_impact only describes the planned change.
+	d.Set("rollout_impact", "")
 	return nil
 }
 
@@ -169,9 +235,31 @@ func resourceGroupDelete(ctx context.Context, d *schema.ResourceData, meta inter
 	appID := d.Get("application_id").(string)
 	groupID := d.Id()
 
-	_, err := c.client.DeleteGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+	if diags := checkProtectedDelete(d, "group", c.protectedGroups); diags.HasError() {
+		return diags
+	}
+
+	diags := checkDeletionProtection(d, c, "group", d.Get("name").(string), func() (int, error) {
+		return groupInstancesCount(ctx, c, appID, groupID)
+	})
+	if diags.HasError() {
+		return diags
+	}
+
+	resp, err := c.client.DeleteGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+	c.lists.invalidate(listKindGroups, appID)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	err = deleteErr(err, func() error {
+		groupResp, err := c.client.GetGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+		if err == nil && groupResp.JSON200 == nil {
+			err = newAPIError(groupResp.HTTPResponse, groupResp.Body)
+		}
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diag.Diagnostics{apiErrorDiag("Couldn't delete group", err, errorAttrs{application: "application_id"})}
 	}
 	return nil
 }
@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/kinvolk/nebraska/backend/pkg/api"
@@ -40,10 +44,13 @@ var (
 	}
 )
 
-// String returns the string representation of the package type
+// String returns the string representation of the package type, empty for
+// types Nebraska doesn't support
 func (pt PackageType) String() string {
 	i := int(pt)
-
+	if i < 1 || i > len(ValidPackageTypes) {
+		return ""
+	}
 	return ValidPackageTypes[i-1]
 }
 
@@ -67,6 +74,10 @@ func resourcePackage() *schema.Resource {
 		ReadContext:   resourcePackageRead,
 		UpdateContext: resourcePackageUpdate,
 		DeleteContext: resourcePackageDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffPackageSourceFile, customizeDiffPackageChannelsBlacklist),
+		Importer: &schema.ResourceImporter{
+			StateContext: resourcePackageImport,
+		},
 
 		Schema: map[string]*schema.Schema{
 			"version": {
@@ -108,21 +119,37 @@ func resourcePackage() *schema.Resource {
 			},
 			"size": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "The size, in bytes.",
+				Optional:    true,
+				Computed:    true,
+				Description: "The size, in bytes. Required unless `source_file` is set.",
 			},
 			"hash": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "A base64 encoded sha1 hash of the package digest. Tip: `cat update.gz | openssl dgst -sha1 -binary | base64`.",
+				Optional:    true,
+				Computed:    true,
+				Description: "A base64 encoded sha1 hash of the package digest. Tip: `cat update.gz | openssl dgst -sha1 -binary | base64`. Required unless `source_file` is set.",
+			},
+			"source_file": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "Path of the local Flatcar update payload of the package. The `size`, `hash` and `flatcar_action` `sha256`, `is_delta`, `metadata_size` and `metadata_signature_rsa` are computed from it unless set. Nebraska doesn't store the payload metadata, it's only kept in the Terraform state.",
 			},
 			"channels_blacklist": {
-				Type:     schema.TypeList,
+				Type:     schema.TypeSet,
 				Optional: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
 				},
-				Description: "A list of channels (by id) that cannot point to this package.",
+				Description: "The channels that cannot point to this package, by name, `<name>/<arch>` when channels of several arches share the name, or ID. A name shared by several arches refers to the channel of the package arch. Names must refer to existing channels when planning, refer to channels created in the same configuration by ID, e.g. `nebraska_channel.beta.id`.",
+			},
+			"channels_blacklist_ids": {
+				Type:     schema.TypeSet,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Description: "The IDs of the `channels_blacklist` channels.",
 			},
 			"flatcar_action": {
 				Type:        schema.TypeList,
@@ -181,10 +208,12 @@ func resourcePackage() *schema.Resource {
 				},
 			},
 			"application_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				ForceNew:    true,
-				Description: "ID of the application this package belongs to.",
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application this package belongs to. Defaults to the provider `default_application`.",
 			},
 			"created_ts": {
 				Type:        schema.TypeString,
@@ -203,19 +232,78 @@ func resourcePackage() *schema.Resource {
 				Type:     schema.TypeString,
 				Optional: true,
 			},
+			"detach_on_destroy": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"fail_if_referenced"},
+				Description:   "Clear the package of the channels still pointing to it before destroying it, instead of leaving it to Nebraska.",
+			},
+			"fail_if_referenced": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"detach_on_destroy"},
+				Description:   "Refuse to destroy the package while channels point to it. When false, Nebraska clears the package of those channels.",
+			},
 		},
 	}
 }
 
 func resourcePackageRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
-	return dataSourcePackageRead(ctx, d, meta)
+	action := d.Get("flatcar_action").([]interface{})
+	blacklist := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
+	diags := dataSourcePackageRead(ctx, d, meta)
+	keepPayloadMetadata(d, action)
+	if diags.HasError() {
+		return diags
+	}
+	return keepChannelsBlacklist(ctx, meta.(*apiClient), d, blacklist)
+}
+
+var packageErrorAttrs = errorAttrs{application: "application_id", unique: "version"}
+
+func resourcePackageImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	c := meta.(*apiClient)
+
+	appID, packageID, err := parseImportID(ctx, c, d.Id())
+	if err != nil {
+		return nil, err
+	}
+	packageResp, err := c.client.GetPackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+	if err == nil && packageResp.JSON200 == nil {
+		err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch package %q: %w", packageID, err)
+	}
+
+	d.Set("application_id", appID)
+	d.Set("arch", api.Arch(packageResp.JSON200.Arch).String())
+	d.Set("detach_on_destroy", false)
+	d.Set("fail_if_referenced", false)
+	if err := packageToResource(*packageResp.JSON200, d); err != nil {
+		return nil, err
+	}
+	if diags := keepChannelsBlacklist(ctx, c, d, nil); diags.HasError() {
+		return nil, fmt.Errorf("couldn't fetch channels: %s", diags[0].Detail)
+	}
+	return []*schema.ResourceData{d}, nil
 }
 
 func resourcePackageCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	c := meta.(*apiClient)
 	var diags diag.Diagnostics
 
-	applicationID := d.Get("application_id").(string)
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	blacklist, diags := packageChannelsBlacklistIDs(ctx, c, appID, d)
+	if diags.HasError() {
+		return diags
+	}
+	d.Set("channels_blacklist_ids", blacklist)
 
 	packageConfig, err := resourceToPackageConfig(d)
 	if err != nil {
@@ -226,24 +314,23 @@ func resourcePackageCreate(ctx context.Context, d *schema.ResourceData, meta int
 		})
 		return diags
 	}
-	packageResp, err := c.client.CreatePackageWithResponse(ctx, applicationID, codegen.CreatePackageJSONRequestBody(codegen.CreatePackageJSONBody(*packageConfig)), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't create package",
-			Detail:   fmt.Sprintf("Got an error when creating package: %v", err),
-		})
-		return diags
+	packageResp, err := c.client.CreatePackageWithResponse(ctx, appID, codegen.CreatePackageJSONRequestBody(codegen.CreatePackageJSONBody(*packageConfig)), c.reqEditors...)
+	c.lists.invalidate(listKindPackages, appID)
+	if err == nil && packageResp.JSON200 == nil {
+		err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
 	}
-	if packageResp.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Creating package", packageResp.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't create package", err, packageErrorAttrs))
 		return diags
 	}
+	action := d.Get("flatcar_action").([]interface{})
+	refs := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
 	err = packageToResource(*packageResp.JSON200, d)
+	keepPayloadMetadata(d, action)
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	return nil
+	return keepChannelsBlacklist(ctx, c, d, refs)
 }
 
 func resourcePackageUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -252,6 +339,11 @@ func resourcePackageUpdate(ctx context.Context, d *schema.ResourceData, meta int
 	var diags diag.Diagnostics
 
 	applicationID := d.Get("application_id").(string)
+	blacklist, diags := packageChannelsBlacklistIDs(ctx, c, applicationID, d)
+	if diags.HasError() {
+		return diags
+	}
+	d.Set("channels_blacklist_ids", blacklist)
 
 	packageConfig, err := resourceToPackageConfig(d)
 	if err != nil {
@@ -263,25 +355,23 @@ func resourcePackageUpdate(ctx context.Context, d *schema.ResourceData, meta int
 		return diags
 	}
 	packageResp, err := c.client.UpdatePackageWithResponse(ctx, applicationID, d.Id(), codegen.UpdatePackageJSONRequestBody(codegen.CreatePackageJSONBody(*packageConfig)), c.reqEditors...)
-	if err != nil {
-		diags = append(diags, diag.Diagnostic{
-			Severity: diag.Error,
-			Summary:  "Couldn't update package",
-			Detail:   fmt.Sprintf("Got an error when updating package:%q error:%v", d.Id(), err),
-		})
-		return diags
-
+	c.lists.invalidate(listKindPackages, applicationID)
+	if err == nil && packageResp.JSON200 == nil {
+		err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
 	}
-	if packageResp.JSON200 == nil {
-		diags = append(diags, invalidResponseCodeDiag("Creating package", packageResp.HTTPResponse))
+	if err != nil {
+		diags = append(diags, apiErrorDiag("Couldn't update package", err, packageErrorAttrs))
 		return diags
 	}
 
+	action := d.Get("flatcar_action").([]interface{})
+	refs := arrInterfaceToarrString(d.Get("channels_blacklist").(*schema.Set).List())
 	err = packageToResource(*packageResp.JSON200, d)
+	keepPayloadMetadata(d, action)
 	if err != nil {
 		return diag.FromErr(err)
 	}
-	return nil
+	return keepChannelsBlacklist(ctx, c, d, refs)
 }
 
 func resourcePackageDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
@@ -290,9 +380,104 @@ func resourcePackageDelete(ctx context.Context, d *schema.ResourceData, meta int
 	appID := d.Get("application_id").(string)
 	packageID := d.Id()
 
-	_, err := c.client.DeletePackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+	if detach := d.Get("detach_on_destroy").(bool); detach || d.Get("fail_if_referenced").(bool) {
+		if diags := detachPackage(ctx, c, appID, packageID, detach); diags.HasError() {
+			for i := range diags {
+				if diags[i].Summary == "Package is in use" {
+					diags[i].Detail += " Use create_before_destroy when replacing the package, or unset fail_if_referenced to let Nebraska clear their package."
+					diags[i].AttributePath = cty.GetAttrPath("fail_if_referenced")
+				}
+			}
+			return diags
+		}
+	}
+
+	resp, err := c.client.DeletePackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+	c.lists.invalidate(listKindPackages, appID)
+	// Nebraska clears the package of the channels still pointing to it.
+	c.lists.invalidate(listKindChannels, appID)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	err = deleteErr(err, func() error {
+		packageResp, err := c.client.GetPackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+		if err == nil && packageResp.JSON200 == nil {
+			err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
+		}
+		return err
+	})
 	if err != nil {
-		return diag.FromErr(err)
+		return diag.Diagnostics{apiErrorDiag("Couldn't delete package", err, errorAttrs{application: "application_id"})}
+	}
+	return nil
+}
+
+// detachPackage clears the package of the channels pointing to it when detach
+// is set, otherwise it fails if there are any. Without it Nebraska clears them
+// on delete, leaving the channels without a package behind Terraform's back.
+func detachPackage(ctx context.Context, c *apiClient, appID string, packageID string, detach bool) diag.Diagnostics {
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch channels", err, errorAttrs{application: "application_id"})}
+	}
+
+	var names []string
+	for _, channel := range channels {
+		if channel.PackageID == packageID {
+			names = append(names, fmt.Sprintf("%s (%s)", channel.Name, api.Arch(channel.Arch).String()))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	if !detach {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Package is in use",
+			Detail:   fmt.Sprintf("Channels %s still point to package %q. Point them to another package first.", strings.Join(names, ", "), packageID),
+		}}
+	}
+
+	defer c.lists.invalidate(listKindChannels, appID)
+	for _, channel := range channels {
+		if channel.PackageID != packageID {
+			continue
+		}
+		channelResp, err := c.client.UpdateChannelWithResponse(ctx, appID, channel.Id, codegen.UpdateChannelJSONRequestBody{
+			Name:          channel.Name,
+			Arch:          uint(channel.Arch),
+			Color:         channel.Color,
+			ApplicationId: appID,
+		}, c.reqEditors...)
+		if err == nil && channelResp.JSON200 == nil {
+			err = newAPIError(channelResp.HTTPResponse, channelResp.Body)
+		}
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't detach channel %q", channel.Name), err, errorAttrs{})}
+		}
+	}
+	return nil
+}
+
+// deleteUnusedPackage deletes a package unless a channel points to it.
+func deleteUnusedPackage(ctx context.Context, c *apiClient, appID string, packageID string) diag.Diagnostics {
+	if diags := detachPackage(ctx, c, appID, packageID, false); diags.HasError() {
+		return diags
+	}
+
+	resp, err := c.client.DeletePackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+	if err == nil && resp.StatusCode() >= 300 {
+		err = newAPIError(resp.HTTPResponse, resp.Body)
+	}
+	err = deleteErr(err, func() error {
+		packageResp, err := c.client.GetPackageWithResponse(ctx, appID, packageID, c.reqEditors...)
+		if err == nil && packageResp.JSON200 == nil {
+			err = newAPIError(packageResp.HTTPResponse, packageResp.Body)
+		}
+		return err
+	})
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't delete package", err, errorAttrs{application: "application_id"})}
 	}
 	return nil
 }
@@ -310,3 +495,87 @@ func expandFlatcarActionSha256(l []interface{}) string {
 
 	return ""
 }
+
+// payloadMetadataKeys are the flatcar_action attributes computed from the
+// source_file that Nebraska doesn't store.
+var payloadMetadataKeys = []string{"is_delta", "metadata_size", "metadata_signature_rsa"}
+
+// customizeDiffPackageSourceFile plans the size, hash and flatcar_action of a
+// package from its source_file, the values set in the configuration take
+// precedence.
+func customizeDiffPackageSourceFile(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	config := d.GetRawConfig()
+	if config.IsNull() || !config.IsKnown() {
+		return nil
+	}
+	if !d.NewValueKnown("source_file") {
+		for _, key := range []string{"size", "hash"} {
+			if config.GetAttr(key).IsNull() {
+				if err := d.SetNewComputed(key); err != nil {
+					return err
+				}
+			}
+		}
+		return d.SetNewComputed("flatcar_action")
+	}
+
+	path := d.Get("source_file").(string)
+	if path == "" {
+		for _, key := range []string{"size", "hash"} {
+			if config.GetAttr(key).IsNull() {
+				return fmt.Errorf("%s is required unless source_file is set", key)
+			}
+		}
+		return nil
+	}
+	if d.Get("type").(string) != PackageTypeFlatcar.String() {
+		return fmt.Errorf("source_file is only supported by flatcar packages")
+	}
+
+	payload, err := readFlatcarPayloadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read source_file: %w", err)
+	}
+	if config.GetAttr("size").IsNull() {
+		if err := d.SetNew("size", strconv.FormatInt(payload.Size, 10)); err != nil {
+			return err
+		}
+	}
+	if config.GetAttr("hash").IsNull() {
+		if err := d.SetNew("hash", payload.SHA1); err != nil {
+			return err
+		}
+	}
+
+	action := map[string]interface{}{}
+	if old := d.Get("flatcar_action").([]interface{}); len(old) > 0 && old[0] != nil {
+		for key, value := range old[0].(map[string]interface{}) {
+			action[key] = value
+		}
+	}
+	if actions := config.GetAttr("flatcar_action"); actions.IsNull() || actions.LengthInt() == 0 {
+		action["sha256"] = payload.SHA256
+	}
+	action["is_delta"] = payload.IsDelta
+	action["metadata_size"] = strconv.FormatUint(payload.MetadataSize, 10)
+	action["metadata_signature_rsa"] = payload.metadataSignatureRSA()
+	return d.SetNew("flatcar_action", []interface{}{action})
+}
+
+// keepPayloadMetadata restores the payload metadata of action, the
+// flatcar_action before reading the package from Nebraska, when the package
+// has a source_file.
+func keepPayloadMetadata(d *schema.ResourceData, action []interface{}) {
+	if d.Get("source_file").(string) == "" || len(action) == 0 || action[0] == nil {
+		return
+	}
+	current := d.Get("flatcar_action").([]interface{})
+	if len(current) == 0 || current[0] == nil {
+		return
+	}
+	kept := current[0].(map[string]interface{})
+	for _, key := range payloadMetadataKeys {
+		kept[key] = action[0].(map[string]interface{})[key]
+	}
+	d.Set("flatcar_action", []interface{}{kept})
+}
@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func resourcePackageRetention() *schema.Resource {
+	retainedPackage := &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Package ID.",
+			},
+			"version": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Package version.",
+			},
+			"arch": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Package arch.",
+			},
+			"created_ts": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "Creation timestamp.",
+			},
+		},
+	}
+
+	return &schema.Resource{
+		Description: "Deletes the packages of an application matching a retention policy on every apply with packages to delete, only those the plan showed in `deleted`. A package is kept when it's one of the `keep_latest` newest of its arch, younger than `keep_days`, listed in `keep_package_ids` or `keep_versions`, or when a channel points to it. The packages aren't restored on destroy.",
+
+		CreateContext: resourcePackageRetentionApply,
+		ReadContext:   resourcePackageRetentionRead,
+		UpdateContext: resourcePackageRetentionApply,
+		DeleteContext: resourcePackageRetentionDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffPackageRetention),
+
+		Schema: map[string]*schema.Schema{
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application of the packages. Defaults to the provider `default_application`.",
+			},
+			"keep_latest": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				AtLeastOneOf: []string{"keep_latest", "keep_days"},
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Keep this many of the newest packages of each arch.",
+			},
+			"keep_days": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				AtLeastOneOf: []string{"keep_latest", "keep_days"},
+				ValidateFunc: validation.IntAtLeast(1),
+				Description:  "Keep the packages created in this many last days.",
+			},
+			"keep_package_ids": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "IDs of packages to keep.",
+			},
+			"keep_versions": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Versions of packages to keep.",
+			},
+			"dry_run": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Only report the packages to delete in `candidates`, without deleting them.",
+			},
+			"candidates": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        retainedPackage,
+				Description: "The packages the policy deletes, kept when `dry_run` is set.",
+			},
+			"deleted": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        retainedPackage,
+				Description: "The packages deleted by the last apply.",
+			},
+		},
+	}
+}
+
+// packageRetentionPolicy selects the packages to delete.
+type packageRetentionPolicy struct {
+	keepLatest int
+	keepDays   int
+	packageIDs map[string]bool
+	versions   map[string]bool
+}
+
+func packageRetentionPolicyFrom(get func(string) interface{}) packageRetentionPolicy {
+	p := packageRetentionPolicy{
+		keepLatest: get("keep_latest").(int),
+		keepDays:   get("keep_days").(int),
+		packageIDs: map[string]bool{},
+		versions:   map[string]bool{},
+	}
+	for _, id := range get("keep_package_ids").(*schema.Set).List() {
+		p.packageIDs[id.(string)] = true
+	}
+	for _, version := range get("keep_versions").(*schema.Set).List() {
+		p.versions[version.(string)] = true
+	}
+	return p
+}
+
+// candidates returns the packages the policy deletes at now, sorted by
+// creation, the packages channels point to are always kept.
+func (p packageRetentionPolicy) candidates(packages []codegen.Package, channels []codegen.Channel, now time.Time) []codegen.Package {
+	used := map[string]bool{}
+	for _, channel := range channels {
+		used[channel.PackageID] = true
+	}
+
+	sorted := append([]codegen.Package(nil), packages...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedTs.After(sorted[j].CreatedTs)
+	})
+	newest := map[codegen.Arch]int{}
+	candidates := []codegen.Package{}
+	for _, pkg := range sorted {
+		newest[pkg.Arch]++
+		switch {
+		case p.keepLatest > 0 && newest[pkg.Arch] <= p.keepLatest:
+		case p.keepDays > 0 && pkg.CreatedTs.After(now.AddDate(0, 0, -p.keepDays)):
+		case used[pkg.Id] || p.packageIDs[pkg.Id] || p.versions[pkg.Version]:
+		default:
+			candidates = append(candidates, pkg)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedTs.Before(candidates[j].CreatedTs)
+	})
+	return candidates
+}
+
+// packageRetentionCandidates returns the packages of the application the
+// policy deletes.
+func packageRetentionCandidates(ctx context.Context, c *apiClient, appID string, policy packageRetentionPolicy) ([]codegen.Package, error) {
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	channels, err := c.listChannels(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	return policy.candidates(packages, channels, time.Now()), nil
+}
+
+func flattenRetainedPackages(packages []codegen.Package) []interface{} {
+	items := make([]interface{}, 0, len(packages))
+	for _, pkg := range packages {
+		items = append(items, map[string]interface{}{
+			"id":         pkg.Id,
+			"version":    pkg.Version,
+			"arch":       api.Arch(pkg.Arch).String(),
+			"created_ts": pkg.CreatedTs.String(),
+		})
+	}
+	return items
+}
+
+// customizeDiffPackageRetention plans the candidates, and their deletion
+// unless in dry run.
+func customizeDiffPackageRetention(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	c := meta.(*apiClient)
+	if !d.NewValueKnown("application_id") {
+		return d.SetNewComputed("candidates")
+	}
+	appRef := d.Get("application_id").(string)
+	if appRef == "" {
+		appRef = c.defaultApplicationID
+	}
+	if appRef == "" {
+		// applying fails with the missing application.
+		return nil
+	}
+	appID, err := c.resolveApplicationID(ctx, appRef)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"keep_latest", "keep_days", "keep_package_ids", "keep_versions"} {
+		if !d.NewValueKnown(key) {
+			return d.SetNewComputed("candidates")
+		}
+	}
+	candidates, err := packageRetentionCandidates(ctx, c, appID, packageRetentionPolicyFrom(d.Get))
+	if err != nil {
+		return fmt.Errorf("couldn't list the packages to delete: %w", err)
+	}
+
+	items := flattenRetainedPackages(candidates)
+	if !reflect.DeepEqual(items, d.Get("candidates")) {
+		if err := d.SetNew("candidates", items); err != nil {
+			return err
+		}
+	}
+	if !d.Get("dry_run").(bool) && len(candidates) > 0 {
+		return d.SetNew("deleted", items)
+	}
+	return nil
+}
+
+func resourcePackageRetentionRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	candidates, err := packageRetentionCandidates(ctx, c, d.Get("application_id").(string), packageRetentionPolicyFrom(d.Get))
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't list the packages to delete", err, errorAttrs{application: "application_id"})}
+	}
+	d.Set("candidates", flattenRetainedPackages(candidates))
+	return nil
+}
+
+func resourcePackageRetentionApply(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	d.SetId(appID)
+
+	candidates, err := packageRetentionCandidates(ctx, c, appID, packageRetentionPolicyFrom(d.Get))
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't list the packages to delete", err, errorAttrs{application: "application_id"})}
+	}
+	if d.Get("dry_run").(bool) {
+		d.Set("candidates", flattenRetainedPackages(candidates))
+		if d.IsNewResource() {
+			d.Set("deleted", []interface{}{})
+		}
+		return nil
+	}
+
+	// only delete the planned candidates, none when they couldn't be planned:
+	// the next plan shows them.
+	if plan := d.GetRawPlan(); !plan.IsNull() && !plan.GetAttr("candidates").IsKnown() {
+		d.Set("candidates", flattenRetainedPackages(candidates))
+		d.Set("deleted", []interface{}{})
+		return nil
+	}
+	planned := map[string]bool{}
+	for _, item := range d.Get("candidates").([]interface{}) {
+		planned[item.(map[string]interface{})["id"].(string)] = true
+	}
+	var unplanned []string
+	for _, pkg := range candidates {
+		if !planned[pkg.Id] {
+			unplanned = append(unplanned, fmt.Sprintf("%s (%s)", pkg.Version, pkg.Id))
+		}
+	}
+	if len(unplanned) > 0 {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "More packages to delete than planned",
+			Detail:   fmt.Sprintf("Packages %s match the retention policy since the plan, plan again to delete them.", strings.Join(unplanned, ", ")),
+		}}
+	}
+
+	deleted := []codegen.Package{}
+	// record the packages deleted before a failure, only the remaining
+	// candidates are planned for the next apply.
+	defer func() {
+		d.Set("deleted", flattenRetainedPackages(deleted))
+		d.Set("candidates", flattenRetainedPackages(candidates[len(deleted):]))
+	}()
+	defer c.lists.invalidate(listKindPackages, appID)
+	for _, pkg := range candidates {
+		if diags := deleteUnusedPackage(ctx, c, appID, pkg.Id); diags.HasError() {
+			return diags
+		}
+		deleted = append(deleted, pkg)
+	}
+	return nil
+}
+
+func resourcePackageRetentionDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// the deleted packages are gone, there's nothing to restore.
+	return nil
+}
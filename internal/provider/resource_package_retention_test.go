@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestPackageRetention(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	daysAgo := func(days int) time.Time { return time.Now().AddDate(0, 0, -days) }
+	fake.packages[testAppID] = []codegen.Package{
+		{Id: "pkg-1", Version: "3374.2.0", Arch: 1, CreatedTs: daysAgo(90)},
+		{Id: "pkg-2", Version: "3374.2.1", Arch: 1, CreatedTs: daysAgo(60)},
+		{Id: "pkg-3", Version: "3374.2.2", Arch: 1, CreatedTs: daysAgo(40)},
+		{Id: "pkg-4", Version: "3510.2.0", Arch: 1, CreatedTs: daysAgo(20)},
+		{Id: "pkg-5", Version: "3510.2.1", Arch: 1, CreatedTs: daysAgo(1)},
+		{Id: "pkg-6", Version: "3374.2.0", Arch: 2, CreatedTs: daysAgo(90)},
+	}
+	fake.channels[testAppID] = []codegen.Channel{{Id: "ch-lts", Name: "lts", Arch: 1, PackageID: "pkg-1"}}
+	c := newFakeClient(t, server, nil)
+
+	r := resourcePackageRetention()
+	cfg := map[string]interface{}{
+		"application_id": "io.kinvolk.demo",
+		"keep_latest":    1,
+		"keep_days":      30,
+		"keep_versions":  []interface{}{"3374.2.2"},
+		"dry_run":        true,
+	}
+
+	// a dry run only reports the candidates.
+	diff, err := r.SimpleDiff(context.Background(), &terraform.InstanceState{}, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	state, diags := r.Apply(context.Background(), &terraform.InstanceState{}, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if state.Attributes["candidates.#"] != "1" || state.Attributes["candidates.0.id"] != "pkg-2" || state.Attributes["deleted.#"] != "0" {
+		t.Errorf("unexpected state %v", state.Attributes)
+	}
+	if len(fake.packages[testAppID]) != 6 {
+		t.Errorf("dry run deleted packages: %#v", fake.packages[testAppID])
+	}
+
+	// a package older than keep_days becomes a candidate.
+	fake.packages[testAppID][3].CreatedTs = daysAgo(35)
+	c.lists.invalidate(listKindPackages, testAppID)
+	state, diags = r.RefreshWithoutUpgrade(context.Background(), state, c)
+	if diags.HasError() {
+		t.Fatalf("refresh failed: %#v", diags)
+	}
+	if state.Attributes["candidates.#"] != "2" || state.Attributes["candidates.1.id"] != "pkg-4" {
+		t.Errorf("unexpected candidates %v", state.Attributes)
+	}
+
+	// the plan shows the packages to delete.
+	cfg["dry_run"] = false
+	diff, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if diff.Attributes["deleted.#"] == nil || diff.Attributes["deleted.#"].New != "2" || diff.Attributes["deleted.1.id"].New != "pkg-4" {
+		t.Errorf("unexpected diff %v", diff.Attributes)
+	}
+
+	// applying fails when more packages match than planned.
+	fake.packages[testAppID] = append(fake.packages[testAppID], codegen.Package{Id: "pkg-7", Version: "3374.1.0", Arch: 2, CreatedTs: daysAgo(100)})
+	c.lists.invalidate(listKindPackages, testAppID)
+	if _, diags := r.Apply(context.Background(), state, diff, c); !diags.HasError() || !strings.Contains(diags[0].Detail, "3374.1.0 (pkg-7)") {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	if len(fake.packages[testAppID]) != 7 {
+		t.Errorf("unplanned apply deleted packages: %#v", fake.packages[testAppID])
+	}
+
+	diff, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	state, diags = r.Apply(context.Background(), state, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if state.Attributes["deleted.#"] != "3" || state.Attributes["deleted.0.version"] != "3374.1.0" || state.Attributes["candidates.#"] != "0" {
+		t.Errorf("unexpected state %v", state.Attributes)
+	}
+	if len(fake.packages[testAppID]) != 4 {
+		t.Errorf("packages weren't deleted: %#v", fake.packages[testAppID])
+	}
+
+	// nothing is left to delete.
+	diff, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(cfg), c)
+	if err != nil || !diff.Empty() {
+		t.Errorf("retention planned %#v, error %v", diff, err)
+	}
+}
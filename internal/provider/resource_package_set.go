@@ -0,0 +1,392 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/api"
+)
+
+func resourcePackageSet() *schema.Resource {
+	return &schema.Resource{
+		Description: "The packages of a version for several architectures, e.g. the amd64 and aarch64 payloads of a Flatcar release. The packages are created, updated and deleted together, like a `nebraska_package` per arch, and configured in a block named after their arch.",
+
+		CreateContext: resourcePackageSetCreate,
+		ReadContext:   resourcePackageSetRead,
+		UpdateContext: resourcePackageSetUpdate,
+		DeleteContext: resourcePackageSetDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffPackageSet),
+		Importer: &schema.ResourceImporter{
+			StateContext: resourcePackageSetImport,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"version": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "Version of the packages.",
+			},
+			"type": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice([]string{"flatcar", "docker", "rkt", "other"}, false),
+				Default:      PackageTypeFlatcar.String(),
+				Description:  "Type of the packages.",
+			},
+			"description": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "A description of the packages.",
+			},
+			"all":     packageSetArchSchema("all"),
+			"amd64":   packageSetArchSchema("amd64"),
+			"aarch64": packageSetArchSchema("aarch64"),
+			"x86":     packageSetArchSchema("x86"),
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application the packages belong to. Defaults to the provider `default_application`.",
+			},
+			"detach_on_destroy": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"fail_if_referenced"},
+				Description:   "Clear the package of the channels still pointing to a package before destroying it, instead of leaving it to Nebraska.",
+			},
+			"fail_if_referenced": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				Default:       false,
+				ConflictsWith: []string{"detach_on_destroy"},
+				Description:   "Refuse to destroy a package while channels point to it. When false, Nebraska clears the package of those channels.",
+			},
+			"package_ids": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the packages by arch.",
+			},
+		},
+	}
+}
+
+// packageSetArchKeys are the arches of the packages of a set, each is the
+// key of the block of its package.
+var packageSetArchKeys = []string{"all", "amd64", "aarch64", "x86"}
+
+// packageSetArchSchema returns the schema of the block of the package of
+// arch. The packages are keyed by arch, so that changing one shows as an
+// update of its block.
+func packageSetArchSchema(arch string) *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeList,
+		Optional:     true,
+		MaxItems:     1,
+		AtLeastOneOf: packageSetArchKeys,
+		Description:  fmt.Sprintf("The `%s` package.", arch),
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"url": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validation.IsURLWithHTTPorHTTPS,
+					Description:  "URL where the package is available.",
+				},
+				"filename": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "The filename of the package.",
+				},
+				"size": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "The size, in bytes.",
+				},
+				"hash": {
+					Type:        schema.TypeString,
+					Required:    true,
+					Description: "A base64 encoded sha1 hash of the package digest.",
+				},
+				"sha256": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Description: "A base64 encoded sha256 hash of the package, the `flatcar_action` `sha256` of Flatcar packages.",
+				},
+			},
+		},
+	}
+}
+
+// customizeDiffPackageSet plans the package_ids when arches are added or
+// removed.
+func customizeDiffPackageSet(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	arches := map[string]bool{}
+	for _, arch := range packageSetArchKeys {
+		if !d.NewValueKnown(arch) {
+			return d.SetNewComputed("package_ids")
+		}
+		if len(d.Get(arch).([]interface{})) > 0 {
+			arches[arch] = true
+		}
+	}
+
+	ids := d.Get("package_ids").(map[string]interface{})
+	changed := len(ids) != len(arches)
+	for arch := range arches {
+		if _, ok := ids[arch]; !ok {
+			changed = true
+		}
+	}
+	if changed {
+		return d.SetNewComputed("package_ids")
+	}
+	return nil
+}
+
+// packageSetPackages returns the package blocks by arch, those before the
+// change being applied when old is set.
+func packageSetPackages(d *schema.ResourceData, old bool) map[string]map[string]interface{} {
+	byArch := map[string]map[string]interface{}{}
+	for _, arch := range packageSetArchKeys {
+		oldBlocks, newBlocks := d.GetChange(arch)
+		blocks := newBlocks.([]interface{})
+		if old {
+			blocks = oldBlocks.([]interface{})
+		}
+		if len(blocks) > 0 && blocks[0] != nil {
+			byArch[arch] = blocks[0].(map[string]interface{})
+		}
+	}
+	return byArch
+}
+
+// packageSetMember returns the nebraska_package data of package p of arch of
+// the set d, the package has the ID id unless it's yet to be created.
+func packageSetMember(d *schema.ResourceData, appID string, id string, arch string, p map[string]interface{}) *schema.ResourceData {
+	m := resourcePackage().Data(&terraform.InstanceState{ID: id})
+	m.Set("application_id", appID)
+	m.Set("version", d.Get("version"))
+	m.Set("type", d.Get("type"))
+	m.Set("description", d.Get("description"))
+	m.Set("detach_on_destroy", d.Get("detach_on_destroy"))
+	m.Set("fail_if_referenced", d.Get("fail_if_referenced"))
+	m.Set("channels_blacklist", []interface{}{})
+	m.Set("arch", arch)
+	if p != nil {
+		m.Set("url", p["url"])
+		m.Set("filename", p["filename"])
+		m.Set("size", p["size"])
+		m.Set("hash", p["hash"])
+		if sha256 := p["sha256"].(string); sha256 != "" {
+			m.Set("flatcar_action", []interface{}{map[string]interface{}{"sha256": sha256}})
+		}
+	}
+	return m
+}
+
+// archDiags tells the arch of the object the diagnostics are about.
+func archDiags(diags diag.Diagnostics, arch string) diag.Diagnostics {
+	for i := range diags {
+		diags[i].Summary = fmt.Sprintf("%s (%s)", diags[i].Summary, arch)
+	}
+	return diags
+}
+
+// packageSetArches returns the arches of the packages, sorted.
+func packageSetArches(m map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func resourcePackageSetImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	c := meta.(*apiClient)
+
+	appID, version, err := parseImportID(ctx, c, d.Id())
+	if err != nil {
+		return nil, err
+	}
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch packages: %w", err)
+	}
+	ids := map[string]interface{}{}
+	for _, pkg := range packages {
+		if pkg.Version == version {
+			ids[api.Arch(pkg.Arch).String()] = pkg.Id
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no package of version %q found", version)
+	}
+
+	d.SetId(appID + "/" + version)
+	d.Set("application_id", appID)
+	d.Set("version", version)
+	d.Set("detach_on_destroy", false)
+	d.Set("fail_if_referenced", false)
+	d.Set("package_ids", ids)
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourcePackageSetRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	packages, err := c.listPackages(ctx, appID)
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch packages", err, errorAttrs{application: "application_id"})}
+	}
+
+	ids := map[string]interface{}{}
+	items := map[string][]interface{}{}
+	for arch, id := range d.Get("package_ids").(map[string]interface{}) {
+		for _, pkg := range packages {
+			if pkg.Id != id.(string) {
+				continue
+			}
+			// read the package like a nebraska_package.
+			m := packageSetMember(d, appID, pkg.Id, arch, nil)
+			if err := packageToResource(pkg, m); err != nil {
+				return diag.FromErr(err)
+			}
+			d.Set("type", m.Get("type"))
+			d.Set("description", m.Get("description"))
+			ids[arch] = pkg.Id
+			items[arch] = []interface{}{map[string]interface{}{
+				"url":      m.Get("url"),
+				"filename": m.Get("filename"),
+				"size":     m.Get("size"),
+				"hash":     m.Get("hash"),
+				"sha256":   expandFlatcarActionSha256(m.Get("flatcar_action").([]interface{})),
+			}}
+		}
+	}
+	// the packages deleted outside of Terraform are created again, the set
+	// is gone with all of them.
+	if len(ids) == 0 {
+		d.SetId("")
+		return nil
+	}
+	d.Set("package_ids", ids)
+	for _, arch := range packageSetArchKeys {
+		d.Set(arch, items[arch])
+	}
+	return nil
+}
+
+func resourcePackageSetCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	d.SetId(appID + "/" + d.Get("version").(string))
+
+	ids := map[string]interface{}{}
+	// record the packages created before a failure, destroying the tainted
+	// set deletes them.
+	defer d.Set("package_ids", ids)
+
+	packages := packageSetPackages(d, false)
+	for _, arch := range packageSetArches(packages) {
+		m := packageSetMember(d, appID, "", arch, packages[arch])
+		if diags := resourcePackageCreate(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		ids[arch] = m.Id()
+	}
+	return nil
+}
+
+func resourcePackageSetUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	// the planned package_ids are unknown, start from the created ones.
+	old, _ := d.GetChange("package_ids")
+	ids := map[string]interface{}{}
+	for arch, id := range old.(map[string]interface{}) {
+		ids[arch] = id
+	}
+	defer d.Set("package_ids", ids)
+
+	before := packageSetPackages(d, true)
+	after := packageSetPackages(d, false)
+	updateAll := d.HasChanges("type", "description")
+
+	for _, arch := range packageSetArches(after) {
+		id, ok := ids[arch]
+		if !ok {
+			m := packageSetMember(d, appID, "", arch, after[arch])
+			if diags := resourcePackageCreate(ctx, m, c); diags.HasError() {
+				return archDiags(diags, arch)
+			}
+			ids[arch] = m.Id()
+			continue
+		}
+		if !updateAll && fmt.Sprint(before[arch]) == fmt.Sprint(after[arch]) {
+			continue
+		}
+		m := packageSetMember(d, appID, id.(string), arch, after[arch])
+		if diags := resourcePackageUpdate(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+	}
+
+	for _, arch := range packageSetArches(before) {
+		id, ok := ids[arch]
+		if _, keep := after[arch]; keep || !ok {
+			continue
+		}
+		m := packageSetMember(d, appID, id.(string), arch, before[arch])
+		if diags := resourcePackageDelete(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		delete(ids, arch)
+	}
+	return nil
+}
+
+func resourcePackageSetDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	ids := d.Get("package_ids").(map[string]interface{})
+	defer d.Set("package_ids", ids)
+
+	packages := packageSetPackages(d, false)
+	arches := make([]string, 0, len(ids))
+	for arch := range ids {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	for _, arch := range arches {
+		m := packageSetMember(d, appID, ids[arch].(string), arch, packages[arch])
+		if diags := resourcePackageDelete(ctx, m, c); diags.HasError() {
+			return archDiags(diags, arch)
+		}
+		delete(ids, arch)
+	}
+	return nil
+}
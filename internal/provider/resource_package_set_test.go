@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestPackageSet(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	c := newFakeClient(t, server, nil)
+
+	r := resourcePackageSet()
+	pkg := func(url string) []interface{} {
+		return []interface{}{map[string]interface{}{
+			"url":      url,
+			"filename": "flatcar_production_update.gz",
+			"size":     "465881871",
+			"hash":     "c2hhMQ==",
+			"sha256":   "c2hhMjU2",
+		}}
+	}
+	configFor := func(packages map[string]interface{}) *terraform.ResourceConfig {
+		config := map[string]interface{}{
+			"application_id": "io.kinvolk.demo",
+			"version":        "3510.2.1",
+			"type":           "flatcar",
+			"description":    "Flatcar 3510.2.1",
+		}
+		for arch, p := range packages {
+			config[arch] = p
+		}
+		return terraform.NewResourceConfigRaw(config)
+	}
+	apply := func(t *testing.T, state *terraform.InstanceState, packages map[string]interface{}) (*terraform.InstanceState, diag.Diagnostics) {
+		diff, err := r.SimpleDiff(context.Background(), state, configFor(packages), c)
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		return r.Apply(context.Background(), state, diff, c)
+	}
+
+	state, diags := apply(t, &terraform.InstanceState{}, map[string]interface{}{
+		"amd64":   pkg("https://update.release.flatcar-linux.net/amd64-usr/3510.2.1/"),
+		"aarch64": pkg("https://update.release.flatcar-linux.net/arm64-usr/3510.2.1/"),
+	})
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	packages := fake.packages[testAppID]
+	if len(packages) != 2 || state.ID != testAppID+"/3510.2.1" {
+		t.Fatalf("got packages %#v, state %#v", packages, state)
+	}
+	for _, p := range packages {
+		arch := "amd64"
+		if p.Arch == 2 {
+			arch = "aarch64"
+		}
+		if state.Attributes["package_ids."+arch] != p.Id || p.Version != "3510.2.1" || p.FlatcarAction == nil || p.FlatcarAction.Sha256 != "c2hhMjU2" {
+			t.Errorf("unexpected package %#v, state %v", p, state.Attributes)
+		}
+	}
+
+	// the aarch64 package is deleted, the amd64 one updated in place.
+	mirror := "https://mirror.example.com/amd64/3510.2.1/"
+	diff, err := r.SimpleDiff(context.Background(), state, configFor(map[string]interface{}{"amd64": pkg(mirror)}), c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	if attr := diff.Attributes["amd64.0.url"]; attr == nil || attr.New != mirror || diff.Attributes["amd64.#"] != nil {
+		t.Errorf("got diff %v, want an update of the amd64 url", diff.Attributes)
+	}
+	state, diags = apply(t, state, map[string]interface{}{"amd64": pkg(mirror)})
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	packages = fake.packages[testAppID]
+	if len(packages) != 1 || packages[0].Url != mirror || state.Attributes["package_ids.%"] != "1" {
+		t.Fatalf("got packages %#v, state %v", packages, state.Attributes)
+	}
+
+	state, diags = r.RefreshWithoutUpgrade(context.Background(), state, c)
+	if diags.HasError() || state.Attributes["amd64.0.url"] != mirror || state.Attributes["aarch64.#"] != "0" || state.Attributes["description"] != "Flatcar 3510.2.1" {
+		t.Fatalf("refresh failed: %#v %v", diags, state)
+	}
+	diff, err = r.SimpleDiff(context.Background(), state, configFor(map[string]interface{}{"amd64": pkg(mirror)}), c)
+	if err != nil || !diff.Empty() {
+		t.Errorf("got diff %v %v after refresh, want none", diff, err)
+	}
+
+	// a set needs a package.
+	if diags := r.Validate(configFor(nil)); !diags.HasError() {
+		t.Errorf("validating a set without packages succeeded")
+	}
+
+	diff = &terraform.InstanceDiff{Destroy: true}
+	if _, diags := r.Apply(context.Background(), state, diff, c); diags.HasError() || len(fake.packages[testAppID]) != 0 {
+		t.Fatalf("destroy failed: %#v %#v", diags, fake.packages[testAppID])
+	}
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestResourcePackageDelete(t *testing.T) {
+	setup := func(t *testing.T) (*fakeNebraska, *apiClient) {
+		fake, server := newDemoNebraska(t)
+		fake.packages[testAppID] = []codegen.Package{{Id: "pkg-1", Version: "3510.2.1", Arch: 1}}
+		fake.channels[testAppID] = []codegen.Channel{{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: "pkg-1"}}
+		return fake, newFakeClient(t, server, nil)
+	}
+	resourceData := func(t *testing.T, config map[string]interface{}) *schema.ResourceData {
+		config["application_id"] = testAppID
+		d := schema.TestResourceDataRaw(t, resourcePackage().Schema, config)
+		d.SetId("pkg-1")
+		return d
+	}
+
+	t.Run("in use", func(t *testing.T) {
+		fake, c := setup(t)
+		if _, err := c.listChannels(context.Background(), testAppID); err != nil {
+			t.Fatal(err)
+		}
+		if diags := resourcePackageDelete(context.Background(), resourceData(t, map[string]interface{}{}), c); diags.HasError() {
+			t.Fatalf("unexpected diagnostics: %#v", diags)
+		}
+		if len(fake.packages[testAppID]) != 0 || fake.channels[testAppID][0].PackageID != "" {
+			t.Fatalf("package in use wasn't deleted: %#v %#v", fake.packages[testAppID], fake.channels[testAppID])
+		}
+		// the listed channels no longer point to the package.
+		if channels, err := c.listChannels(context.Background(), testAppID); err != nil || channels[0].PackageID != "" {
+			t.Errorf("got channels %#v %v after the delete", channels, err)
+		}
+	})
+
+	t.Run("fail if referenced", func(t *testing.T) {
+		fake, c := setup(t)
+		diags := resourcePackageDelete(context.Background(), resourceData(t, map[string]interface{}{"fail_if_referenced": true}), c)
+		if !diags.HasError() || !strings.Contains(diags[0].Detail, "stable (amd64)") || !strings.Contains(diags[0].Detail, "fail_if_referenced") {
+			t.Fatalf("unexpected diagnostics: %#v", diags)
+		}
+		if len(fake.packages[testAppID]) != 1 {
+			t.Fatalf("package in use was deleted")
+		}
+	})
+
+	t.Run("detach", func(t *testing.T) {
+		fake, c := setup(t)
+		if diags := resourcePackageDelete(context.Background(), resourceData(t, map[string]interface{}{"detach_on_destroy": true}), c); diags.HasError() {
+			t.Fatalf("unexpected diagnostics: %#v", diags)
+		}
+		if len(fake.packages[testAppID]) != 0 || fake.channels[testAppID][0].PackageID != "" {
+			t.Fatalf("package wasn't detached and deleted: %#v %#v", fake.packages[testAppID], fake.channels[testAppID])
+		}
+	})
+
+	t.Run("already deleted", func(t *testing.T) {
+		fake, c := setup(t)
+		fake.packages[testAppID] = nil
+		fake.channels[testAppID] = nil
+		if diags := resourcePackageDelete(context.Background(), resourceData(t, map[string]interface{}{}), c); diags.HasError() {
+			t.Fatalf("deleting a missing package failed: %#v", diags)
+		}
+	})
+}
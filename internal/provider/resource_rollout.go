@@ -0,0 +1,447 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// defaultRolloutTimeout bounds applying a whole rollout, waves may take hours.
+const defaultRolloutTimeout = 24 * time.Hour
+
+func resourceRollout() *schema.Resource {
+	return &schema.Resource{
+		Description: "A staged rollout of a package to groups, in waves. Applying it advances wave by wave: the groups of a wave are moved to its channel, pointed to its package, and the rollout waits for the success criteria of the wave before the next one. A wave failing its criteria halts the rollout, applying again resumes it from that wave. A rollout halted while being created is created anyway, with a warning, so that it resumes too. Changing the waves replaces the rollout, starting it over. The rollout changes the `package_id` of the channels and the `channel_id` of the groups of its waves, the `nebraska_channel` and `nebraska_group` resources managing them must list these in `ignore_changes`, applying them reverts the rollout otherwise.",
+
+		CreateContext: resourceRolloutApply,
+		ReadContext:   resourceRolloutRead,
+		UpdateContext: resourceRolloutApply,
+		DeleteContext: resourceRolloutDelete,
+		CustomizeDiff: customdiff.Sequence(customizeDiffApplicationID, customizeDiffRollout),
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(defaultRolloutTimeout),
+			Update: schema.DefaultTimeout(defaultRolloutTimeout),
+		},
+
+		Schema: map[string]*schema.Schema{
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application of the groups. Defaults to the provider `default_application`.",
+			},
+			"wave": {
+				Type:        schema.TypeList,
+				Required:    true,
+				ForceNew:    true,
+				MinItems:    1,
+				Description: "The waves of the rollout, in order.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "Name of the wave, e.g. `canary`.",
+						},
+						"groups": {
+							Type:        schema.TypeList,
+							Required:    true,
+							ForceNew:    true,
+							MinItems:    1,
+							Elem:        &schema.Schema{Type: schema.TypeString},
+							Description: "IDs of the groups of the wave.",
+						},
+						"channel_id": {
+							Type:        schema.TypeString,
+							Required:    true,
+							ForceNew:    true,
+							Description: "ID of the channel the groups are moved to.",
+						},
+						"package_id": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							ForceNew:    true,
+							Description: "ID of the package the channel is pointed to. The channel keeps its package when unset.",
+						},
+						"min_updated_percent": {
+							Type:         schema.TypeFloat,
+							Optional:     true,
+							ForceNew:     true,
+							Default:      100,
+							ValidateFunc: validation.FloatBetween(0, 100),
+							Description:  "Percentage of the active instances of the groups that must run the version of the package.",
+						},
+						"max_error_percent": {
+							Type:         schema.TypeFloat,
+							Optional:     true,
+							ForceNew:     true,
+							Default:      0,
+							ValidateFunc: validation.FloatBetween(0, 100),
+							Description:  "Percentage of the active instances of the groups in error above which the rollout halts.",
+						},
+						"soak_duration": {
+							Type:             schema.TypeString,
+							Optional:         true,
+							ForceNew:         true,
+							Default:          "0 seconds",
+							ValidateFunc:     validateInterval,
+							DiffSuppressFunc: suppressEquivalentInterval,
+							Description:      "How long the wave must keep within `max_error_percent` once enough instances were updated, e.g. `30 minutes`.",
+						},
+						"timeout": {
+							Type:             schema.TypeString,
+							Optional:         true,
+							ForceNew:         true,
+							Default:          "1 hours",
+							ValidateFunc:     validateInterval,
+							DiffSuppressFunc: suppressEquivalentInterval,
+							Description:      "How long to wait for `min_updated_percent` of the instances to be updated before halting.",
+						},
+					},
+				},
+			},
+			"poll_interval": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "1 minutes",
+				ValidateFunc:     validateInterval,
+				DiffSuppressFunc: suppressEquivalentInterval,
+				Description:      "How often the status of the groups is checked.",
+			},
+			"completed_waves": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The number of waves completed, the rollout is done when all of them are.",
+			},
+		},
+	}
+}
+
+// customizeDiffRollout plans the rollout again while waves are left, it
+// resumes from the first one not completed.
+func customizeDiffRollout(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || d.HasChange("wave") || d.Get("completed_waves").(int) < d.Get("wave.#").(int) {
+		return d.SetNewComputed("completed_waves")
+	}
+	return nil
+}
+
+// rolloutWave is a wave of a rollout.
+type rolloutWave struct {
+	name              string
+	groups            []string
+	channelID         string
+	packageID         string
+	minUpdatedPercent float64
+	maxErrorPercent   float64
+	soak              time.Duration
+	timeout           time.Duration
+}
+
+func rolloutWaves(d *schema.ResourceData) []rolloutWave {
+	var waves []rolloutWave
+	for _, w := range d.Get("wave").([]interface{}) {
+		m := w.(map[string]interface{})
+		// the intervals were validated by the schema.
+		soak, _ := parseInterval(m["soak_duration"].(string))
+		timeout, _ := parseInterval(m["timeout"].(string))
+		waves = append(waves, rolloutWave{
+			name:              m["name"].(string),
+			groups:            arrInterfaceToarrString(m["groups"].([]interface{})),
+			channelID:         m["channel_id"].(string),
+			packageID:         m["package_id"].(string),
+			minUpdatedPercent: m["min_updated_percent"].(float64),
+			maxErrorPercent:   m["max_error_percent"].(float64),
+			soak:              soak,
+			timeout:           timeout,
+		})
+	}
+	return waves
+}
+
+func resourceRolloutRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	_, err := c.listGroups(ctx, d.Get("application_id").(string))
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"})}
+	}
+	return nil
+}
+
+func resourceRolloutApply(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	if d.Id() == "" {
+		d.SetId(appID + "/" + rolloutWavesHash(d))
+	}
+
+	// resume the rollout, changing the waves replaces it.
+	completed, _ := d.GetChange("completed_waves")
+	start := completed.(int)
+	if d.IsNewResource() {
+		start = 0
+	}
+	waves := rolloutWaves(d)
+	if start > len(waves) {
+		start = 0
+	}
+	d.Set("completed_waves", start)
+	pollInterval, _ := parseInterval(d.Get("poll_interval").(string))
+
+	for i := start; i < len(waves); i++ {
+		w := waves[i]
+		version, diags := startWave(ctx, c, appID, w)
+		if diags.HasError() {
+			return rolloutHalted(d, diags)
+		}
+		log.Printf("[INFO] rollout %s: wave %q started, rolling out %s to groups %s", d.Id(), w.name, version, strings.Join(w.groups, ", "))
+		if diags := waitForWave(ctx, c, appID, w, version, pollInterval); diags.HasError() {
+			for j := range diags {
+				diags[j].Detail = fmt.Sprintf("Wave %q (%d of %d) halted: %s Apply again to resume the rollout from this wave.", w.name, i+1, len(waves), diags[j].Detail)
+			}
+			return rolloutHalted(d, diags)
+		}
+		log.Printf("[INFO] rollout %s: wave %q completed", d.Id(), w.name)
+		d.Set("completed_waves", i+1)
+	}
+	return nil
+}
+
+// rolloutHalted returns the diagnostics of a halted rollout. A failed create
+// taints the rollout, which would start it over, so a rollout halted while
+// being created is kept with the waves completed so far and only warns.
+func rolloutHalted(d *schema.ResourceData, diags diag.Diagnostics) diag.Diagnostics {
+	if !d.IsNewResource() {
+		return diags
+	}
+	for i := range diags {
+		diags[i].Severity = diag.Warning
+	}
+	return diags
+}
+
+// rolloutWavesHash returns a hash of the waves, a rollout is replaced when
+// they change.
+func rolloutWavesHash(d *schema.ResourceData) string {
+	waves, _ := json.Marshal(d.Get("wave"))
+	sum := sha256.Sum256(waves)
+	return hex.EncodeToString(sum[:])
+}
+
+func resourceRolloutDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	// the groups stay where the rollout left them.
+	return nil
+}
+
+// startWave points the channel of w to its package and moves the groups of w
+// to the channel, it returns the version rolled out.
+func startWave(ctx context.Context, c *apiClient, appID string, w rolloutWave) (string, diag.Diagnostics) {
+	channelResp, err := c.client.GetChannelWithResponse(ctx, appID, w.channelID, c.reqEditors...)
+	if err == nil && channelResp.JSON200 == nil {
+		err = newAPIError(channelResp.HTTPResponse, channelResp.Body)
+	}
+	if err != nil {
+		return "", diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't fetch channel %q", w.channelID), err, errorAttrs{})}
+	}
+	channel := *channelResp.JSON200
+
+	if w.packageID != "" && channel.PackageID != w.packageID {
+		updateResp, err := c.client.UpdateChannelWithResponse(ctx, appID, channel.Id, codegen.UpdateChannelJSONRequestBody{
+			Name:          channel.Name,
+			Arch:          uint(channel.Arch),
+			Color:         channel.Color,
+			ApplicationId: appID,
+			PackageId:     &w.packageID,
+		}, c.reqEditors...)
+		c.lists.invalidate(listKindChannels, appID)
+		if err == nil && updateResp.JSON200 == nil {
+			err = newAPIError(updateResp.HTTPResponse, updateResp.Body)
+		}
+		if err != nil {
+			return "", diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't point channel %q to package %q", channel.Name, w.packageID), err, errorAttrs{})}
+		}
+		channel.PackageID = w.packageID
+	}
+	if channel.PackageID == "" {
+		return "", diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Channel has no package",
+			Detail:   fmt.Sprintf("Channel %q of wave %q has no package to roll out, set the package_id of the wave.", channel.Name, w.name),
+		}}
+	}
+
+	for _, groupID := range w.groups {
+		groupResp, err := c.client.GetGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+		if err == nil && groupResp.JSON200 == nil {
+			err = newAPIError(groupResp.HTTPResponse, groupResp.Body)
+		}
+		if err != nil {
+			return "", diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't fetch group %q", groupID), err, errorAttrs{})}
+		}
+		if groupResp.JSON200.ChannelID == channel.Id {
+			continue
+		}
+		config := groupToConfig(*groupResp.JSON200)
+		config.ChannelId = &channel.Id
+		updateResp, err := c.client.UpdateGroupWithResponse(ctx, appID, groupID, codegen.UpdateGroupJSONRequestBody(config), c.reqEditors...)
+		c.lists.invalidate(listKindGroups, appID)
+		if err == nil && updateResp.JSON200 == nil {
+			err = newAPIError(updateResp.HTTPResponse, updateResp.Body)
+		}
+		if err != nil {
+			return "", diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't move group %q to channel %q", groupResp.JSON200.Name, channel.Name), err, errorAttrs{})}
+		}
+	}
+	return packageVersion(ctx, c, appID, channel.PackageID), nil
+}
+
+// groupRolloutStatus is the progress of a rollout in a group.
+type groupRolloutStatus struct {
+	name string
+	// instances is the number of active instances, updated those running
+	// the version rolled out and errors those whose update failed.
+	instances int
+	updated   int
+	errors    int
+}
+
+// waveStatus is the progress of a wave in each of its groups.
+type waveStatus []groupRolloutStatus
+
+func (s waveStatus) percents() (updated float64, errors float64) {
+	var instances, updatedCount, errorCount int
+	for _, g := range s {
+		instances += g.instances
+		updatedCount += g.updated
+		errorCount += g.errors
+	}
+	// a wave without instances has nothing to update.
+	if instances == 0 {
+		return 100, 0
+	}
+	return 100 * float64(updatedCount) / float64(instances), 100 * float64(errorCount) / float64(instances)
+}
+
+// String describes the progress in each group, e.g. "canary: 812 of 1,000
+// instances (81.2%) updated to 3510.2.2, 3 in error (0.3%)".
+func (s waveStatus) String() string {
+	percent := func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(total)
+	}
+	lines := make([]string, 0, len(s))
+	for _, g := range s {
+		lines = append(lines, fmt.Sprintf("%s: %s of %s instances (%.1f%%) updated, %s in error (%.1f%%)",
+			g.name, formatCount(g.updated), formatCount(g.instances), percent(g.updated, g.instances), formatCount(g.errors), percent(g.errors, g.instances)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// waveProgress returns the progress of rolling version out to the groups.
+func waveProgress(ctx context.Context, c *apiClient, appID string, groups []string, version string) (waveStatus, error) {
+	status := make(waveStatus, 0, len(groups))
+	for _, groupID := range groups {
+		groupResp, err := c.client.GetGroupWithResponse(ctx, appID, groupID, c.reqEditors...)
+		if err == nil && groupResp.JSON200 == nil {
+			err = newAPIError(groupResp.HTTPResponse, groupResp.Body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch group %q: %w", groupID, err)
+		}
+		statsResp, err := c.client.GetGroupInstanceStatsWithResponse(ctx, appID, groupID, &codegen.GetGroupInstanceStatsParams{Duration: activeInstancesDuration}, c.reqEditors...)
+		if err == nil && statsResp.JSON200 == nil {
+			err = newAPIError(statsResp.HTTPResponse, statsResp.Body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch the instance stats of group %q: %w", groupResp.JSON200.Name, err)
+		}
+		versionsResp, err := c.client.GetGroupVersionBreakdownWithResponse(ctx, appID, groupID, c.reqEditors...)
+		if err == nil && versionsResp.JSON200 == nil {
+			err = newAPIError(versionsResp.HTTPResponse, versionsResp.Body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't fetch the versions of group %q: %w", groupResp.JSON200.Name, err)
+		}
+
+		g := groupRolloutStatus{
+			name:      groupResp.JSON200.Name,
+			instances: statsResp.JSON200.Total,
+			errors:    statsResp.JSON200.Error,
+		}
+		for _, entry := range *versionsResp.JSON200 {
+			if entry.Version == version && entry.Instances != nil {
+				g.updated += *entry.Instances
+			}
+		}
+		status = append(status, g)
+	}
+	return status, nil
+}
+
+// waitForWave polls the progress of w until enough instances were updated to
+// version and the wave soaked, or its criteria fail.
+func waitForWave(ctx context.Context, c *apiClient, appID string, w rolloutWave, version string, pollInterval time.Duration) diag.Diagnostics {
+	halt := func(format string, args ...interface{}) diag.Diagnostics {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Rollout halted",
+			Detail:   fmt.Sprintf(format, args...),
+		}}
+	}
+
+	deadline := time.Now().Add(w.timeout)
+	var soakedAt time.Time
+	for {
+		status, err := waveProgress(ctx, c, appID, w.groups, version)
+		if err != nil {
+			return diag.Diagnostics{apiErrorDiag("Couldn't check the rollout", err, errorAttrs{})}
+		}
+		updated, errors := status.percents()
+		log.Printf("[DEBUG] wave %q: %.1f%% updated to %s, %.1f%% in error", w.name, updated, version, errors)
+
+		if errors > w.maxErrorPercent {
+			return halt("%.1f%% of the instances are in error, above max_error_percent %g%%.\n%s\n", errors, w.maxErrorPercent, status)
+		}
+		if soakedAt.IsZero() && updated >= w.minUpdatedPercent {
+			soakedAt = time.Now().Add(w.soak)
+		}
+		if !soakedAt.IsZero() && !time.Now().Before(soakedAt) {
+			return nil
+		}
+		if soakedAt.IsZero() && time.Now().After(deadline) {
+			return halt("%.1f%% of the instances were updated to %s within %s, below min_updated_percent %g%%.\n%s\n", updated, version, formatInterval(w.timeout), w.minUpdatedPercent, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return halt("%v while %.1f%% of the instances were updated to %s.\n%s\n", ctx.Err(), updated, version, status)
+		case <-time.After(pollInterval):
+		}
+	}
+}
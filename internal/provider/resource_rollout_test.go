@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestRollout(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{{Id: "pkg-1", Version: "3510.2.1"}, {Id: "pkg-2", Version: "3510.2.2"}}
+	fake.channels[testAppID] = []codegen.Channel{
+		{Id: "ch-canary", Name: "canary", Arch: 1, PackageID: "pkg-1"},
+		{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: "pkg-1"},
+	}
+	fake.groups[testAppID] = []codegen.Group{
+		{Id: "grp-canary", Name: "canary", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+		{Id: "grp-prod", Name: "prod", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+	}
+	instances := func(n int) *int { return &n }
+	fake.stats["grp-canary"] = codegen.GroupInstanceStats{Total: 10}
+	fake.versions["grp-canary"] = codegen.GroupVersionBreakdown{{Version: "3510.2.2", Instances: instances(10)}}
+	fake.stats["grp-prod"] = codegen.GroupInstanceStats{Total: 100, Error: 20}
+	fake.versions["grp-prod"] = codegen.GroupVersionBreakdown{
+		{Version: "3510.2.2", Instances: instances(90)},
+		{Version: "3510.2.1", Instances: instances(10)},
+	}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceRollout()
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"application_id": testAppID,
+		"poll_interval":  "10 milliseconds",
+		"wave": []interface{}{
+			map[string]interface{}{
+				"name":       "canary",
+				"groups":     []interface{}{"grp-canary"},
+				"channel_id": "ch-canary",
+				"package_id": "pkg-2",
+			},
+			map[string]interface{}{
+				"name":                "prod",
+				"groups":              []interface{}{"grp-prod"},
+				"channel_id":          "ch-stable",
+				"package_id":          "pkg-2",
+				"min_updated_percent": 80,
+				"max_error_percent":   5,
+				"soak_duration":       "20ms",
+				"timeout":             "50ms",
+			},
+		},
+	})
+	apply := func(t *testing.T, state *terraform.InstanceState) (*terraform.InstanceState, diag.Diagnostics) {
+		diff, err := r.SimpleDiff(context.Background(), state, config, c)
+		if err != nil {
+			t.Fatalf("diff failed: %v", err)
+		}
+		return r.Apply(context.Background(), state, diff, c)
+	}
+
+	// the canary wave completes, the prod one has too many errors. The
+	// rollout is created anyway, to resume from the prod wave.
+	state, diags := apply(t, &terraform.InstanceState{})
+	if diags.HasError() || len(diags) != 1 || !strings.Contains(diags[0].Detail, `Wave "prod" (2 of 2) halted: 20.0% of the instances are in error`) ||
+		!strings.Contains(diags[0].Detail, "prod: 90 of 100 instances (90.0%) updated, 20 in error (20.0%)") {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+	if state.Attributes["completed_waves"] != "1" || !strings.HasPrefix(state.ID, testAppID+"/") {
+		t.Errorf("got completed waves %q, ID %q", state.Attributes["completed_waves"], state.ID)
+	}
+	if fake.groups[testAppID][0].ChannelID != "ch-canary" || fake.channels[testAppID][0].PackageID != "pkg-2" {
+		t.Errorf("canary wave wasn't started: %#v %#v", fake.groups[testAppID][0], fake.channels[testAppID][0])
+	}
+
+	// too few instances are updated in time.
+	fake.stats["grp-prod"] = codegen.GroupInstanceStats{Total: 100}
+	fake.versions["grp-prod"][0].Instances = instances(50)
+	state, diags = apply(t, state)
+	if !diags.HasError() || !strings.Contains(diags[0].Detail, "50.0% of the instances were updated to 3510.2.2 within") {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+
+	// the rollout resumes from the prod wave.
+	fake.versions["grp-prod"][0].Instances = instances(90)
+	fake.channels[testAppID][0].PackageID = "pkg-1"
+	state, diags = apply(t, state)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if state.Attributes["completed_waves"] != "2" || fake.channels[testAppID][0].PackageID != "pkg-1" || fake.channels[testAppID][1].PackageID != "pkg-2" {
+		t.Errorf("rollout wasn't resumed: %v %#v", state.Attributes, fake.channels[testAppID])
+	}
+
+	diff, err := r.SimpleDiff(context.Background(), state, config, c)
+	if err != nil || !diff.Empty() {
+		t.Errorf("completed rollout planned %#v, error %v", diff, err)
+	}
+
+	// changing the waves replaces the rollout.
+	changed := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"application_id": testAppID,
+		"wave": []interface{}{
+			map[string]interface{}{
+				"name":       "canary",
+				"groups":     []interface{}{"grp-canary"},
+				"channel_id": "ch-canary",
+				"package_id": "pkg-1",
+			},
+		},
+	})
+	diff, err = r.SimpleDiff(context.Background(), state, changed, c)
+	if err != nil || !diff.RequiresNew() {
+		t.Errorf("changing the waves planned %#v, error %v", diff, err)
+	}
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func resourceUpdateFreeze() *schema.Resource {
+	return &schema.Resource{
+		Description: "Stops the updates of all the groups of an application, e.g. during an incident. Creating it disables the updates of every group, destroying it restores their previous `policy_updates_enabled`. Groups whose updates are enabled while the freeze is active are reported in `drift`, and in warnings when the freeze is refreshed. An application can only have one freeze at a time, a freeze is refused when every group already has its updates disabled. `nebraska_group` resources of the application whose `policy_updates_enabled` is true, also through a `policy_preset` or the provider `group_policy_defaults`, re-enable their updates when applied during the freeze, add it to their `ignore_changes` while the freeze is active.",
+
+		CreateContext: resourceUpdateFreezeCreate,
+		ReadContext:   resourceUpdateFreezeRead,
+		DeleteContext: resourceUpdateFreezeDelete,
+		CustomizeDiff: customizeDiffApplicationID,
+
+		Schema: map[string]*schema.Schema{
+			"application_id": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validateApplicationID,
+				Description:  "ID or product ID of the application to freeze. Defaults to the provider `default_application`.",
+			},
+			"previous_updates_enabled": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeBool},
+				Description: "The `policy_updates_enabled` of each group before the freeze, by group ID, restored on destroy.",
+			},
+			"drift": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The groups whose updates are enabled while the freeze is active.",
+			},
+		},
+	}
+}
+
+// updateFreezeDrift describes the groups of groups whose updates are enabled,
+// previous are the recorded policy_updates_enabled.
+func updateFreezeDrift(groups []codegen.Group, previous map[string]interface{}) []string {
+	drift := []string{}
+	for _, group := range groups {
+		if !group.PolicyUpdatesEnabled {
+			continue
+		}
+		if _, ok := previous[group.Id]; ok {
+			drift = append(drift, fmt.Sprintf("group %q (%s) has updates enabled", group.Name, group.Id))
+		} else {
+			drift = append(drift, fmt.Sprintf("group %q (%s) was created with updates enabled", group.Name, group.Id))
+		}
+	}
+	sort.Strings(drift)
+	return drift
+}
+
+// setGroupUpdatesEnabled sets the policy_updates_enabled of group.
+func setGroupUpdatesEnabled(ctx context.Context, c *apiClient, appID string, group codegen.Group, enabled bool) error {
+	config := groupToConfig(group)
+	config.PolicyUpdatesEnabled = &enabled
+	groupResp, err := c.client.UpdateGroupWithResponse(ctx, appID, group.Id, codegen.UpdateGroupJSONRequestBody(config), c.reqEditors...)
+	c.lists.invalidate(listKindGroups, appID)
+	if err == nil && groupResp.JSON200 == nil {
+		err = newAPIError(groupResp.HTTPResponse, groupResp.Body)
+	}
+	return err
+}
+
+func resourceUpdateFreezeRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	groups, err := c.listGroups(ctx, d.Get("application_id").(string))
+	if isNotFound(err) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"})}
+	}
+	drift := updateFreezeDrift(groups, d.Get("previous_updates_enabled").(map[string]interface{}))
+	d.Set("drift", drift)
+
+	var diags diag.Diagnostics
+	for _, group := range drift {
+		diags = append(diags, diag.Diagnostic{
+			Severity:      diag.Warning,
+			Summary:       "Update freeze drift",
+			Detail:        fmt.Sprintf("The update freeze of application %s is active, but %s.", d.Id(), group),
+			AttributePath: cty.GetAttrPath("drift"),
+		})
+	}
+	return diags
+}
+
+func resourceUpdateFreezeCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+
+	appID, err := applicationID(ctx, d, c)
+	if err != nil {
+		return applicationIDDiag(err)
+	}
+	groups, err := c.listGroups(ctx, appID)
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"})}
+	}
+	// a second freeze would record every group as disabled, and destroying
+	// the first one would lift both.
+	frozen := len(groups) > 0
+	for _, group := range groups {
+		frozen = frozen && !group.PolicyUpdatesEnabled
+	}
+	if frozen {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Application already frozen",
+			Detail:        fmt.Sprintf("All the groups of application %s already have their updates disabled, e.g. by another update freeze.", appID),
+			AttributePath: cty.GetAttrPath("application_id"),
+		}}
+	}
+
+	d.SetId(appID)
+	previous := map[string]interface{}{}
+	// record the groups disabled before a failure, destroying the tainted
+	// freeze enables their updates again.
+	defer d.Set("previous_updates_enabled", previous)
+	d.Set("drift", []string{})
+
+	for _, group := range groups {
+		if group.PolicyUpdatesEnabled {
+			if err := setGroupUpdatesEnabled(ctx, c, appID, group, false); err != nil {
+				return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't disable the updates of group %q", group.Name), err, errorAttrs{})}
+			}
+		}
+		previous[group.Id] = group.PolicyUpdatesEnabled
+	}
+	return nil
+}
+
+func resourceUpdateFreezeDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	c := meta.(*apiClient)
+	appID := d.Get("application_id").(string)
+
+	previous := d.Get("previous_updates_enabled").(map[string]interface{})
+	// keep track of the groups left to restore when failing.
+	defer d.Set("previous_updates_enabled", previous)
+
+	groups, err := c.listGroups(ctx, appID)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return diag.Diagnostics{apiErrorDiag("Couldn't fetch groups", err, errorAttrs{application: "application_id"})}
+	}
+	for _, group := range groups {
+		enabled, ok := previous[group.Id].(bool)
+		if !ok {
+			continue
+		}
+		if group.PolicyUpdatesEnabled != enabled {
+			if err := setGroupUpdatesEnabled(ctx, c, appID, group, enabled); err != nil {
+				return diag.Diagnostics{apiErrorDiag(fmt.Sprintf("Couldn't restore the updates of group %q", group.Name), err, errorAttrs{})}
+			}
+		}
+		delete(previous, group.Id)
+	}
+	return nil
+}
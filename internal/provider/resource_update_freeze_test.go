@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestUpdateFreeze(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.groups[testAppID] = []codegen.Group{
+		{Id: "grp-eu", Name: "prod-eu", ChannelID: "ch-stable", PolicyUpdatesEnabled: true, PolicyPeriodInterval: "1 hours"},
+		{Id: "grp-paused", Name: "paused", ChannelID: "ch-stable"},
+	}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceUpdateFreeze()
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{"application_id": "io.kinvolk.demo"})
+	diff, err := r.SimpleDiff(context.Background(), &terraform.InstanceState{}, config, c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	state, diags := r.Apply(context.Background(), &terraform.InstanceState{}, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %#v", diags)
+	}
+	if fake.groups[testAppID][0].PolicyUpdatesEnabled || fake.groups[testAppID][0].PolicyPeriodInterval != "1 hours" {
+		t.Errorf("group wasn't frozen: %#v", fake.groups[testAppID][0])
+	}
+	if state.Attributes["previous_updates_enabled.grp-eu"] != "true" || state.Attributes["previous_updates_enabled.grp-paused"] != "false" {
+		t.Errorf("unexpected state %v", state.Attributes)
+	}
+
+	// a second freeze is refused.
+	if _, diags := r.Apply(context.Background(), &terraform.InstanceState{}, diff, c); !diags.HasError() || diags[0].Summary != "Application already frozen" {
+		t.Errorf("second freeze didn't fail: %#v", diags)
+	}
+
+	// updates enabled during the freeze are reported.
+	fake.groups[testAppID][1].PolicyUpdatesEnabled = true
+	fake.groups[testAppID] = append(fake.groups[testAppID], codegen.Group{Id: "grp-new", Name: "new", PolicyUpdatesEnabled: true})
+	c.lists.invalidate(listKindGroups, testAppID)
+	state, diags = r.RefreshWithoutUpgrade(context.Background(), state, c)
+	if diags.HasError() {
+		t.Fatalf("refresh failed: %#v", diags)
+	}
+	want := []string{`group "new" (grp-new) was created with updates enabled`, `group "paused" (grp-paused) has updates enabled`}
+	if state.Attributes["drift.#"] != "2" || state.Attributes["drift.0"] != want[0] || state.Attributes["drift.1"] != want[1] {
+		t.Errorf("unexpected drift %v", state.Attributes)
+	}
+	if len(diags) != 2 || diags[0].Severity != diag.Warning || !strings.HasSuffix(diags[1].Detail, want[1]+".") {
+		t.Errorf("unexpected diagnostics: %#v", diags)
+	}
+
+	// destroying restores the recorded values, the new group is left alone.
+	if _, diags := r.Apply(context.Background(), state, &terraform.InstanceDiff{Destroy: true}, c); diags.HasError() {
+		t.Fatalf("destroy failed: %#v", diags)
+	}
+	groups := fake.groups[testAppID]
+	if !groups[0].PolicyUpdatesEnabled || groups[1].PolicyUpdatesEnabled || !groups[2].PolicyUpdatesEnabled {
+		t.Errorf("groups weren't restored: %#v", groups)
+	}
+}
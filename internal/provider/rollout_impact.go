@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+// customizeDiffChannelRolloutImpact describes in rollout_impact the updates
+// that changing the package of a channel rolls out to the groups using it.
+func customizeDiffChannelRolloutImpact(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("package_id") {
+		return nil
+	}
+	c := meta.(*apiClient)
+	appID, _ := d.GetChange("application_id")
+	oldPackageID, newPackageID := d.GetChange("package_id")
+
+	groups, err := c.listGroups(ctx, appID.(string))
+	if err != nil {
+		log.Printf("[WARN] couldn't assess the rollout impact of channel %s: %v", d.Id(), err)
+		return nil
+	}
+	var updating []codegen.Group
+	for _, group := range groups {
+		if group.ChannelID == d.Id() && group.PolicyUpdatesEnabled {
+			updating = append(updating, group)
+		}
+	}
+	if len(updating) == 0 {
+		return nil
+	}
+
+	to := "a new package"
+	if d.NewValueKnown("package_id") {
+		to = packageVersion(ctx, c, appID.(string), newPackageID.(string))
+	}
+	return setRolloutImpact(ctx, d, c, appID.(string), updating, packageVersion(ctx, c, appID.(string), oldPackageID.(string)), to)
+}
+
+// customizeDiffGroupRolloutImpact describes in rollout_impact the updates
+// that enabling updates on a group, or moving it to another channel, rolls
+// out.
+func customizeDiffGroupRolloutImpact(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.Get("policy_updates_enabled").(bool) {
+		return nil
+	}
+	if !d.HasChange("policy_updates_enabled") && !d.HasChange("channel_id") {
+		return nil
+	}
+	if !d.NewValueKnown("channel_id") || d.Get("channel_id").(string) == "" {
+		return nil
+	}
+	c := meta.(*apiClient)
+	appID, _ := d.GetChange("application_id")
+	channelID := d.Get("channel_id").(string)
+
+	channelResp, err := c.client.GetChannelWithResponse(ctx, appID.(string), channelID, c.reqEditors...)
+	if err == nil && channelResp.JSON200 == nil {
+		err = newAPIError(channelResp.HTTPResponse, channelResp.Body)
+	}
+	if err != nil {
+		log.Printf("[WARN] couldn't assess the rollout impact of group %s: %v", d.Id(), err)
+		return nil
+	}
+	if channelResp.JSON200.PackageID == "" {
+		return nil
+	}
+
+	group := codegen.Group{Id: d.Id(), Name: d.Get("name").(string)}
+	return setRolloutImpact(ctx, d, c, appID.(string), []codegen.Group{group}, "", packageVersion(ctx, c, appID.(string), channelResp.JSON200.PackageID))
+}
+
+// setRolloutImpact sets rollout_impact to the summary of rolling the active
+// instances of groups from one version to another, from may be empty when
+// the instances run various versions.
+func setRolloutImpact(ctx context.Context, d *schema.ResourceDiff, c *apiClient, appID string, groups []codegen.Group, from string, to string) error {
+	instances := 0
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		count, err := groupInstancesCount(ctx, c, appID, group.Id)
+		if err != nil {
+			log.Printf("[WARN] couldn't count the instances of group %s: %v", group.Id, err)
+			return nil
+		}
+		instances += count
+		names = append(names, group.Name)
+	}
+	if instances == 0 {
+		return nil
+	}
+
+	impact := rolloutImpact(instances, names, from, to)
+	log.Printf("[WARN] %s", impact)
+	return d.SetNew("rollout_impact", impact)
+}
+
+// rolloutImpact formats the summary of a rollout.
+func rolloutImpact(instances int, groups []string, from string, to string) string {
+	noun := "group"
+	if len(groups) > 1 {
+		noun = "groups"
+	}
+	impact := fmt.Sprintf("this change will roll %s instances in %s %s", formatCount(instances), noun, strings.Join(groups, ", "))
+	if from != "" {
+		impact += " from " + from
+	}
+	return impact + " to " + to
+}
+
+// packageVersion returns the version of a package, or its ID when it can't
+// be found.
+func packageVersion(ctx context.Context, c *apiClient, appID string, packageID string) string {
+	if packageID == "" {
+		return "no package"
+	}
+	packages, err := c.listPackages(ctx, appID)
+	if err != nil {
+		return packageID
+	}
+	for _, pkg := range packages {
+		if pkg.Id == packageID {
+			return pkg.Version
+		}
+	}
+	return packageID
+}
+
+// formatCount formats n with thousands separators, e.g. 1,240.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestFormatCount(t *testing.T) {
+	cases := map[int]string{0: "0", 999: "999", 1000: "1,000", 1240: "1,240", 1234567: "1,234,567", -1240: "-1,240"}
+	for n, want := range cases {
+		if got := formatCount(n); got != want {
+			t.Errorf("formatCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestChannelRolloutImpact(t *testing.T) {
+	fake, server := newDemoNebraska(t)
+	fake.packages[testAppID] = []codegen.Package{{Id: "pkg-1", Version: "3510.2.1"}, {Id: "pkg-2", Version: "3510.2.2"}}
+	fake.channels[testAppID] = []codegen.Channel{{Id: "ch-stable", Name: "stable", Arch: 1, PackageID: "pkg-1"}}
+	fake.groups[testAppID] = []codegen.Group{
+		{Id: "grp-eu", Name: "prod-eu", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+		{Id: "grp-us", Name: "prod-us", ChannelID: "ch-stable", PolicyUpdatesEnabled: true},
+		{Id: "grp-paused", Name: "paused", ChannelID: "ch-stable"},
+	}
+	fake.instances["grp-eu"] = 1000
+	fake.instances["grp-us"] = 240
+	fake.instances["grp-paused"] = 50
+	c := newFakeClient(t, server, nil)
+
+	state := &terraform.InstanceState{ID: "ch-stable", Attributes: map[string]string{
+		"id":             "ch-stable",
+		"name":           "stable",
+		"arch":           "amd64",
+		"application_id": testAppID,
+		"color":          "",
+		"package_id":     "pkg-1",
+	}}
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":           "stable",
+		"arch":           "amd64",
+		"application_id": testAppID,
+		"package_id":     "pkg-2",
+	})
+	r := resourceChannel()
+	diff, err := r.Diff(context.Background(), state, config, c)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	want := "this change will roll 1,240 instances in groups prod-eu, prod-us from 3510.2.1 to 3510.2.2"
+	if got := diff.Attributes["rollout_impact"]; got == nil || got.New != want {
+		t.Fatalf("got rollout_impact %#v, want %q", got, want)
+	}
+
+	state, diags := r.Apply(context.Background(), state, diff, c)
+	if diags.HasError() {
+		t.Fatalf("apply failed: %v", diags)
+	}
+	if got := state.Attributes["rollout_impact"]; got != "" {
+		t.Fatalf("got rollout_impact %q after apply, want it cleared", got)
+	}
+	if diff, err = r.Diff(context.Background(), state, config, c); err != nil || diff != nil && len(diff.Attributes) > 0 {
+		t.Fatalf("got diff %#v, %v after apply, want none", diff, err)
+	}
+}
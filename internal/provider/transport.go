@@ -0,0 +1,184 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRetryAfterAttempts is the number of times a request answered with
+	// a Retry-After header is retried.
+	maxRetryAfterAttempts = 3
+	// maxRetryAfterWait caps the wait requested by a Retry-After header.
+	maxRetryAfterWait = time.Minute
+)
+
+// rateLimitedTransport is a http.RoundTripper that limits the rate and the
+// concurrency of the requests sent to the Nebraska server and retries the
+// requests the server asks to retry later.
+type rateLimitedTransport struct {
+	next http.RoundTripper
+
+	// interval is the minimum time between two requests, zero means
+	// unlimited.
+	interval time.Duration
+	mu       sync.Mutex
+	nextSlot time.Time
+
+	// inFlight bounds the number of requests in flight, nil means unlimited.
+	inFlight chan struct{}
+}
+
+// newRateLimitedTransport returns a transport sending at most
+// requestsPerSecond requests per second with at most maxInFlight of them in
+// flight. Zero disables the respective limit.
+func newRateLimitedTransport(next http.RoundTripper, requestsPerSecond float64, maxInFlight int) *rateLimitedTransport {
+	t := &rateLimitedTransport{next: next}
+	if requestsPerSecond > 0 {
+		t.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	if maxInFlight > 0 {
+		t.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return t
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, ok := retryAfter(resp)
+		if !ok || attempt >= maxRetryAfterAttempts {
+			return resp, nil
+		}
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *rateLimitedTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.inFlight != nil {
+		select {
+		case t.inFlight <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if err := t.waitForSlot(req); err != nil {
+		t.release()
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.release()
+		return nil, err
+	}
+	// the request stays in flight until its body is consumed.
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: t.release}
+	return resp, nil
+}
+
+// waitForSlot blocks until the request may be sent under the rate limit.
+func (t *rateLimitedTransport) waitForSlot(req *http.Request) error {
+	if t.interval == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	t.nextSlot = slot.Add(t.interval)
+	t.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *rateLimitedTransport) release() {
+	if t.inFlight != nil {
+		<-t.inFlight
+	}
+}
+
+// releasingBody releases the in-flight slot of a request once, when its
+// response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// retryAfter returns the wait requested by the Retry-After header of a 429 or
+// 503 response.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
+	} else {
+		return 0, false
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	if wait > maxRetryAfterWait {
+		wait = maxRetryAfterWait
+	}
+	return wait, true
+}
@@ -1,27 +1,19 @@
 package provider
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	"github.com/kinvolk/nebraska/backend/pkg/api"
 	"github.com/kinvolk/nebraska/backend/pkg/codegen"
 )
 
-func invalidResponseCodeDiag(step string, resp *http.Response) diag.Diagnostic {
-	respBody, _ := ioutil.ReadAll(resp.Body)
-	return diag.Diagnostic{
-		Severity: diag.Error,
-		Summary:  step,
-		Detail:   fmt.Sprintf("Got invalid response code:%d\n resp:%s", resp.StatusCode, string(respBody)),
-	}
-}
-
 func keyToStringPointer(d *schema.ResourceData, key string) *string {
 	if v, ok := d.Get(key).(string); ok {
 		return &v
@@ -46,6 +38,128 @@ func arrInterfaceToarrString(interfaces []interface{}) []string {
 	return strings
 }
 
+// applicationID returns the canonical ID of the application referenced by
+// application_id, falling back to the provider's default_application when it
+// is omitted. The resolved ID is stored back into d.
+func applicationID(ctx context.Context, d *schema.ResourceData, c *apiClient) (string, error) {
+	ref, ok := d.GetOk("application_id")
+	if !ok {
+		if c.defaultApplicationID == "" {
+			return "", errors.New("'application_id' is required when the provider 'default_application' is not set")
+		}
+		d.Set("application_id", c.defaultApplicationID)
+		return c.defaultApplicationID, nil
+	}
+	appID, err := c.resolveApplicationID(ctx, ref.(string))
+	if err != nil {
+		return "", err
+	}
+	d.Set("application_id", appID)
+	return appID, nil
+}
+
+// resolveApplicationID resolves an application ID or product ID into the
+// application ID, caching lookups for the lifetime of the provider.
+func (c *apiClient) resolveApplicationID(ctx context.Context, ref string) (string, error) {
+	if _, errs := validation.IsUUID(ref, "application_id"); len(errs) == 0 {
+		return ref, nil
+	}
+
+	c.appIDsMu.Lock()
+	appID, ok := c.appIDs[ref]
+	c.appIDsMu.Unlock()
+	if ok {
+		return appID, nil
+	}
+
+	// the lock isn't held during the request, a slow lookup doesn't block the
+	// others, concurrent lookups of the same product ID resolve it twice.
+	appResp, err := c.client.GetAppWithResponse(ctx, ref, c.reqEditors...)
+	if err == nil && appResp.JSON200 == nil {
+		err = newAPIError(appResp.HTTPResponse, appResp.Body)
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't fetch application %q: %w", ref, err)
+	}
+
+	c.appIDsMu.Lock()
+	defer c.appIDsMu.Unlock()
+	if c.appIDs == nil {
+		c.appIDs = map[string]string{}
+	}
+	c.appIDs[ref] = appResp.JSON200.Id
+	return appResp.JSON200.Id, nil
+}
+
+// customizeDiffApplicationID suppresses the application_id diff when the
+// configured reference resolves to the application already in state, so that
+// switching between an ID and a product ID doesn't force a new resource. An
+// unset application_id refers to the provider default_application, the
+// resource is replaced when that's another application.
+func customizeDiffApplicationID(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.NewValueKnown("application_id") {
+		return nil
+	}
+	c := meta.(*apiClient)
+
+	old, new := d.GetChange("application_id")
+	ref, unset := new.(string), new.(string) == ""
+	if config := d.GetRawConfig(); config.IsKnown() && !config.IsNull() && config.GetAttr("application_id").IsNull() {
+		// the computed application_id keeps its state value, plan the default
+		// instead.
+		unset = true
+	}
+	if unset {
+		ref = c.defaultApplicationID
+	}
+	if !unset && !d.HasChange("application_id") || ref == "" {
+		return nil
+	}
+
+	appID, err := c.resolveApplicationID(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if appID == old.(string) {
+		return d.Clear("application_id")
+	}
+	if !unset {
+		return nil
+	}
+	if err := d.SetNew("application_id", appID); err != nil {
+		return err
+	}
+	return d.ForceNew("application_id")
+}
+
+// validateApplicationID accepts either an application ID or a product ID.
+func validateApplicationID(v interface{}, key string) ([]string, []error) {
+	if _, errs := validation.IsUUID(v, key); len(errs) == 0 {
+		return nil, nil
+	}
+	return validateProductID(v, key)
+}
+
+func applicationIDDiag(err error) diag.Diagnostics {
+	d := apiErrorDiag("Missing application", err, errorAttrs{application: "application_id"})
+	d.AttributePath = cty.GetAttrPath("application_id")
+	return diag.Diagnostics{d}
+}
+
+// parseImportID splits an import ID of the form <application_id>/<id>, the
+// application may be referenced by ID or product ID.
+func parseImportID(ctx context.Context, c *apiClient, importID string) (appID string, id string, err error) {
+	parts := strings.Split(importID, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("unexpected import ID %q, expected <application_id>/<id>", importID)
+	}
+	appID, err = c.resolveApplicationID(ctx, parts[0])
+	if err != nil {
+		return "", "", err
+	}
+	return appID, parts[1], nil
+}
+
 // app
 func resourceToAppConfig(d *schema.ResourceData) (*codegen.AppConfig, error) {
 
@@ -108,6 +222,23 @@ func resourceToGroupConfig(d *schema.ResourceData) *codegen.GroupConfig {
 	}
 }
 
+// groupToConfig returns the config of group, to update it with changes.
+func groupToConfig(group codegen.Group) codegen.GroupConfig {
+	return codegen.GroupConfig{
+		Name:                      group.Name,
+		PolicyMaxUpdatesPerPeriod: group.PolicyMaxUpdatesPerPeriod,
+		PolicyPeriodInterval:      group.PolicyPeriodInterval,
+		PolicyTimezone:            group.PolicyTimezone,
+		PolicyUpdateTimeout:       group.PolicyUpdateTimeout,
+		ChannelId:                 &group.ChannelID,
+		Description:               &group.Description,
+		Track:                     &group.Track,
+		PolicyOfficeHours:         &group.PolicyOfficeHours,
+		PolicySafeMode:            &group.PolicySafeMode,
+		PolicyUpdatesEnabled:      &group.PolicyUpdatesEnabled,
+	}
+}
+
 func groupToResourceData(group codegen.Group, d *schema.ResourceData) {
 	d.Set("name", group.Name)
 	d.Set("description", group.Description)
@@ -118,9 +249,9 @@ func groupToResourceData(group codegen.Group, d *schema.ResourceData) {
 	d.Set("policy_safe_mode", group.PolicySafeMode)
 	d.Set("policy_office_hours", group.PolicyOfficeHours)
 	d.Set("policy_timezone", group.PolicyTimezone)
-	d.Set("policy_period_interval", group.PolicyPeriodInterval)
+	d.Set("policy_period_interval", normalizeInterval(group.PolicyPeriodInterval))
 	d.Set("policy_max_updates_per_period", group.PolicyMaxUpdatesPerPeriod)
-	d.Set("policy_update_timeout", group.PolicyUpdateTimeout)
+	d.Set("policy_update_timeout", normalizeInterval(group.PolicyUpdateTimeout))
 	d.Set("track", group.Track)
 
 }
@@ -171,7 +302,7 @@ func resourceToPackageConfig(d *schema.ResourceData) (*codegen.PackageConfig, er
 	return &codegen.PackageConfig{
 		ApplicationId:     d.Get("application_id").(string),
 		Arch:              int(arch),
-		ChannelsBlacklist: arrInterfaceToarrString(d.Get("channels_blacklist").([]interface{})),
+		ChannelsBlacklist: arrInterfaceToarrString(d.Get("channels_blacklist_ids").(*schema.Set).List()),
 		Description:       d.Get("description").(string),
 		Filename:          d.Get("filename").(string),
 		Hash:              d.Get("hash").(string),
@@ -199,7 +330,7 @@ func packageToResource(nebraskaPackage codegen.Package, d *schema.ResourceData)
 		d.Set("type", "git")
 		fmt.Println("set type to git")
 	} else {
-		d.Set("type", pkgTypeToString[nebraskaPackage.Type])
+		d.Set("type", PackageType(nebraskaPackage.Type).String())
 	}
 	d.SetId(nebraskaPackage.Id)
 	d.Set("url", nebraskaPackage.Url)
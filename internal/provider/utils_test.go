@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/kinvolk/nebraska/backend/pkg/codegen"
+)
+
+func TestApplicationIDDefault(t *testing.T) {
+	_, server := newDemoNebraska(t)
+
+	t.Run("default application", func(t *testing.T) {
+		c := newFakeClient(t, server, map[string]interface{}{"default_application": "io.kinvolk.demo"})
+		d := schema.TestResourceDataRaw(t, resourceGroup().Schema, map[string]interface{}{"name": "prod"})
+		got, err := applicationID(context.Background(), d, c)
+		if err != nil || got != testAppID || d.Get("application_id") != testAppID {
+			t.Errorf("got %q, %v, application_id %q, want %q", got, err, d.Get("application_id"), testAppID)
+		}
+	})
+
+	t.Run("missing application", func(t *testing.T) {
+		c := newFakeClient(t, server, nil)
+		d := schema.TestResourceDataRaw(t, resourceGroup().Schema, map[string]interface{}{"name": "prod"})
+		_, err := applicationID(context.Background(), d, c)
+		if err == nil {
+			t.Fatal("expected an error without application_id nor default_application")
+		}
+		diags := applicationIDDiag(err)
+		if diags[0].Summary != "Missing application" || !strings.Contains(diags[0].Detail, "'application_id' is required") {
+			t.Errorf("unexpected diagnostics %#v", diags)
+		}
+	})
+}
+
+func TestResolveApplicationID(t *testing.T) {
+	fake, _ := newFakeNebraska(t)
+	fake.apps = []codegen.Application{
+		{Id: testAppID, ProductId: "io.kinvolk.demo", Name: "Demo"},
+		{Id: "e96281a6-d1af-4bde-9a0a-97b76e56dc57", ProductId: "io.kinvolk.slow", Name: "Slow"},
+	}
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/io.kinvolk.slow") {
+			<-release
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	defer close(release)
+	c := newFakeClient(t, server, nil)
+
+	got, err := c.resolveApplicationID(context.Background(), "io.kinvolk.demo")
+	if err != nil || got != testAppID {
+		t.Fatalf("got %q, %v, want %q", got, err, testAppID)
+	}
+	if _, err := c.resolveApplicationID(context.Background(), "io.kinvolk.missing"); err == nil {
+		t.Errorf("resolving a missing product ID didn't fail")
+	}
+
+	// a lookup waiting on the server doesn't block the cached ones.
+	go c.resolveApplicationID(context.Background(), "io.kinvolk.slow")
+	time.Sleep(10 * time.Millisecond)
+	fake.mu.Lock()
+	fake.apps = nil
+	fake.mu.Unlock()
+	done := make(chan string)
+	go func() {
+		got, _ := c.resolveApplicationID(context.Background(), "io.kinvolk.demo")
+		done <- got
+	}()
+	select {
+	case got := <-done:
+		if got != testAppID {
+			t.Errorf("got cached %q, want %q", got, testAppID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached lookup blocked by a pending one")
+	}
+}
+
+func TestCustomizeDiffApplicationID(t *testing.T) {
+	fake, server := newFakeNebraska(t)
+	fake.apps = []codegen.Application{
+		{Id: testAppID, ProductId: "io.kinvolk.demo", Name: "Demo"},
+		{Id: "e96281a6-d1af-4bde-9a0a-97b76e56dc57", ProductId: "io.kinvolk.other", Name: "Other"},
+	}
+	c := newFakeClient(t, server, nil)
+
+	r := resourceUpdateFreeze()
+	state := &terraform.InstanceState{ID: testAppID, Attributes: map[string]string{
+		"id": testAppID, "application_id": testAppID, "drift.#": "0", "previous_updates_enabled.%": "0",
+	}}
+	diff, err := r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(map[string]interface{}{"application_id": "io.kinvolk.demo"}), c)
+	if err != nil || !diff.Empty() {
+		t.Errorf("product ID of the same application planned %#v, error %v", diff, err)
+	}
+
+	diff, err = r.SimpleDiff(context.Background(), state, terraform.NewResourceConfigRaw(map[string]interface{}{"application_id": "io.kinvolk.other"}), c)
+	if err != nil || diff.Empty() || !diff.RequiresNew() {
+		t.Errorf("another application planned %#v, error %v", diff, err)
+	}
+
+	// without application_id the default application is planned.
+	unset := state.DeepCopy()
+	unset.RawConfig = rawConfig(r, nil)
+	for _, tc := range []struct {
+		defaultApplication string
+		replace            bool
+	}{{"io.kinvolk.demo", false}, {"io.kinvolk.other", true}} {
+		c := newFakeClient(t, server, map[string]interface{}{"default_application": tc.defaultApplication})
+		diff, err := r.SimpleDiff(context.Background(), unset, terraform.NewResourceConfigRaw(map[string]interface{}{}), c)
+		if err != nil || diff.RequiresNew() != tc.replace || tc.replace && diff.Attributes["application_id"].New != "e96281a6-d1af-4bde-9a0a-97b76e56dc57" {
+			t.Errorf("unset application_id with default %s planned %#v, error %v", tc.defaultApplication, diff, err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 	"github.com/yolossn/terraform-provider-nebraska/internal/provider"
@@ -27,6 +29,12 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	var debugMode bool
 
 	flag.BoolVar(&debugMode, "debug", false, "set to true to run the provider with support for debuggers like delve")
@@ -43,3 +51,38 @@ func main() {
 
 	plugin.Serve(opts)
 }
+
+// commands are the subcommands of the provider binary, they return the exit
+// code of the process.
+var commands = map[string]func(args []string) int{
+	"doctor": runDoctor,
+	"export": runExport,
+}
+
+// providerConfigFlags registers the provider arguments as flags on fs. The
+// returned function builds the provider configuration from the flags that
+// were set, the others fall back to their environment variables and defaults.
+func providerConfigFlags(fs *flag.FlagSet) func() map[string]interface{} {
+	args := map[string]*string{
+		"endpoint":     fs.String("endpoint", "", "address of the Nebraska server (env NEBRASKA_ENDPOINT)"),
+		"auth_mode":    fs.String("auth-mode", "", "auth mode of the Nebraska server: noop, github or oidc (env NEBRASKA_AUTH_MODE)"),
+		"github_token": fs.String("github-token", "", "token used with the github auth mode (env NEBRASKA_GH_TOKEN)"),
+		"username":     fs.String("username", "", "username used with the oidc auth mode (env NEBRASKA_USERNAME)"),
+		"password":     fs.String("password", "", "password used with the oidc auth mode (env NEBRASKA_PASSWORD)"),
+	}
+	return func() map[string]interface{} {
+		config := map[string]interface{}{}
+		for name, value := range args {
+			if *value != "" {
+				config[name] = *value
+			}
+		}
+		return config
+	}
+}
+
+func usageError(fs *flag.FlagSet, err error) int {
+	fmt.Fprintf(fs.Output(), "%s: %v\n", fs.Name(), err)
+	fs.Usage()
+	return 2
+}